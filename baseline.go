@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+var (
+	// known problems loaded from the baseline, with the number of occurrences
+	baselineKeys       = make(map[string]int)
+	suppressedProblems = 0
+)
+
+// Baseline file
+type baseline struct {
+	Version  int               `json:"version"`
+	Findings []baselineFinding `json:"findings"`
+}
+
+// Baseline finding, matched on URL, category & normalized message
+type baselineFinding struct {
+	URL      string `json:"url"`
+	Category string `json:"category"`
+	Message  string `json:"message"`
+	Count    int    `json:"count"`
+}
+
+// Return the baseline key of a problem
+func baselineKey(url, category, message string) string {
+	return url + "\x00" + category + "\x00" + normalizeMessage(message)
+}
+
+// Normalize a message so whitespace & case differences do not matter
+func normalizeMessage(message string) string {
+	return strings.ToLower(strings.Join(strings.Fields(message), " "))
+}
+
+// Write all the problems of the crawl to a baseline file
+func writeBaseline(file string, crawl *validator.Report) error {
+	counts := make(map[string]*baselineFinding)
+
+	err := crawl.EachResult(func(r validator.Result) error {
+		for _, i := range r.Issues {
+			k := baselineKey(r.URL, i.Category, i.Message)
+			if f, ok := counts[k]; ok {
+				f.Count++
+				continue
+			}
+			counts[k] = &baselineFinding{
+				URL:      r.URL,
+				Category: i.Category,
+				Message:  normalizeMessage(i.Message),
+				Count:    1,
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b := baseline{Version: 1, Findings: []baselineFinding{}}
+	for _, f := range counts {
+		b.Findings = append(b.Findings, *f)
+	}
+
+	// sort for stable diffs
+	sort.Slice(b.Findings, func(i, j int) bool {
+		a, c := b.Findings[i], b.Findings[j]
+		if a.URL != c.URL {
+			return a.URL < c.URL
+		}
+		if a.Category != c.Category {
+			return a.Category < c.Category
+		}
+		return a.Message < c.Message
+	})
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// Load a baseline file
+func loadBaseline(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	b := baseline{}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+
+	for _, f := range b.Findings {
+		baselineKeys[baselineKey(f.URL, f.Category, f.Message)] += f.Count
+	}
+
+	return nil
+}
+
+// Remove the issues known in the baseline from the counters of the crawl. The
+// issues are removed from the results when reporting (see report.each).
+func applyBaseline(crawl *validator.Report) error {
+	if len(baselineKeys) == 0 {
+		return nil
+	}
+
+	remaining := baselineRemaining()
+
+	return crawl.EachResult(func(r validator.Result) error {
+		for _, i := range filterBaseline(&r, remaining) {
+			suppressedProblems++
+
+			switch i.Severity {
+			case validator.SeverityError:
+				crawl.ErrorsProcessed--
+			case validator.SeverityWarning:
+				crawl.WarningsProcessed--
+			default:
+				crawl.NoticesProcessed--
+			}
+		}
+		return nil
+	})
+}
+
+// Return the number of times each known issue is allowed
+func baselineRemaining() map[string]int {
+	remaining := make(map[string]int, len(baselineKeys))
+	for k, v := range baselineKeys {
+		remaining[k] = v
+	}
+
+	return remaining
+}
+
+// Return a filter of the issues of each result not known in the baseline, so
+// known errors are not counted towards --fail-fast-after
+func failFastIssues() func(r validator.Result) []validator.Issue {
+	remaining := baselineRemaining()
+	mutex := sync.Mutex{}
+
+	return func(r validator.Result) []validator.Issue {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		filterBaseline(&r, remaining)
+
+		return r.Issues
+	}
+}
+
+// Remove the issues of a result known in the baseline, each allowed as many
+// times as remaining, and return the issues removed
+func filterBaseline(r *validator.Result, remaining map[string]int) []validator.Issue {
+	issues := []validator.Issue{}
+	removed := []validator.Issue{}
+
+	for _, i := range r.Issues {
+		k := baselineKey(r.URL, i.Category, i.Message)
+		if remaining[k] == 0 {
+			issues = append(issues, i)
+			continue
+		}
+
+		remaining[k]--
+		removed = append(removed, i)
+	}
+
+	r.Issues = issues
+
+	return removed
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+func TestFilterBaseline(t *testing.T) {
+	issue := func(category, message string) validator.Issue {
+		return validator.Issue{Category: category, Severity: validator.SeverityError, Message: message}
+	}
+
+	r := validator.Result{URL: "https://example.com/", Issues: []validator.Issue{
+		issue("validation", "Element “div” not allowed"),
+		issue("validation", "Element “div” not allowed"),
+		issue("validation", "Element “div” not allowed"),
+		issue("validation", "Stray end tag"),
+		issue("broken-link", "returned status 404"),
+	}}
+
+	tests := []struct {
+		name      string
+		remaining map[string]int
+		removed   int
+		left      string // the messages of the issues left
+	}{
+		{"empty baseline", map[string]int{}, 0, "Element “div” not allowed, Element “div” not allowed, Element “div” not allowed, Stray end tag, returned status 404"},
+		{"fewer occurrences known", map[string]int{
+			baselineKey(r.URL, "validation", "Element “div” not allowed"): 2,
+		}, 2, "Element “div” not allowed, Stray end tag, returned status 404"},
+		{"more occurrences known", map[string]int{
+			baselineKey(r.URL, "validation", "Element “div” not allowed"): 5,
+		}, 3, "Stray end tag, returned status 404"},
+		{"normalized message", map[string]int{
+			baselineKey(r.URL, "validation", "  stray END   tag "): 1,
+		}, 1, "Element “div” not allowed, Element “div” not allowed, Element “div” not allowed, returned status 404"},
+		{"other category", map[string]int{
+			baselineKey(r.URL, "redirect", "returned status 404"): 1,
+		}, 0, "Element “div” not allowed, Element “div” not allowed, Element “div” not allowed, Stray end tag, returned status 404"},
+		{"other URL", map[string]int{
+			baselineKey("https://example.com/other", "broken-link", "returned status 404"): 1,
+		}, 0, "Element “div” not allowed, Element “div” not allowed, Element “div” not allowed, Stray end tag, returned status 404"},
+	}
+
+	for _, tt := range tests {
+		res := r
+		removed := filterBaseline(&res, tt.remaining)
+
+		left := []string{}
+		for _, i := range res.Issues {
+			left = append(left, i.Message)
+		}
+
+		if len(removed) != tt.removed || strings.Join(left, ", ") != tt.left {
+			t.Errorf("%s: expected %d removed leaving %q, got %d removed leaving %q", tt.name, tt.removed, tt.left, len(removed), strings.Join(left, ", "))
+		}
+	}
+
+	// the occurrences are shared by all the results filtered
+	remaining := map[string]int{baselineKey(r.URL, "validation", "Stray end tag"): 1}
+	for n, want := range []int{1, 0} {
+		res := r
+		if removed := filterBaseline(&res, remaining); len(removed) != want {
+			t.Errorf("result %d: expected %d removed, got %d", n+1, want, len(removed))
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// config files looked for in the working directory if --config is not set
+	configFiles = []string{".web-validator.yml", ".web-validator.yaml"}
+
+	// flags which cannot be set in a config file
+	configIgnoredFlags = []string{"config", "profile", "help", "update", "version"}
+)
+
+// Find the config file in the working directory, if any
+func findConfigFile() string {
+	for _, f := range configFiles {
+		if info, err := os.Stat(f); err == nil && !info.IsDir() {
+			return f
+		}
+	}
+
+	return ""
+}
+
+// Load a config file & optional profile, setting all flags which were not
+// set on the command line. Profile values override the top-level values.
+// The URL from the config file is returned, if set.
+func applyConfig(flag *pflag.FlagSet, file, profile string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	conf := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return "", fmt.Errorf("error parsing %s: %s", file, err)
+	}
+
+	profiles := make(map[string]map[string]interface{})
+	if p, ok := conf["profiles"]; ok {
+		out, err := yaml.Marshal(p)
+		if err != nil {
+			return "", err
+		}
+		if err := yaml.Unmarshal(out, &profiles); err != nil {
+			return "", fmt.Errorf("error parsing profiles in %s: %s", file, err)
+		}
+		delete(conf, "profiles")
+	}
+
+	layers := []map[string]interface{}{}
+
+	if profile != "" {
+		p, ok := profiles[profile]
+		if !ok {
+			return "", fmt.Errorf("profile %q not found in %s", profile, file)
+		}
+		layers = append(layers, p)
+	}
+
+	layers = append(layers, conf)
+
+	startURL := ""
+
+	for _, values := range layers {
+		// sorted for consistent error messages
+		keys := []string{}
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			v := values[k]
+
+			if k == "url" {
+				if startURL == "" {
+					startURL = configValue(v)
+				}
+				continue
+			}
+
+			f := flag.Lookup(k)
+			if f == nil || isConfigIgnored(k) {
+				return "", fmt.Errorf("invalid option in %s: %s", file, k)
+			}
+
+			// command-line flags & previous layers take precedence
+			if f.Changed {
+				continue
+			}
+
+			if err := flag.Set(k, configValue(v)); err != nil {
+				return "", fmt.Errorf("invalid value for %s in %s: %s", k, file, err)
+			}
+		}
+	}
+
+	return startURL, nil
+}
+
+// Whether a flag cannot be set in a config file
+func isConfigIgnored(name string) bool {
+	for _, f := range configIgnoredFlags {
+		if f == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return a config value as a flag value, joining lists with commas
+func configValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		parts := []string{}
+		for _, p := range val {
+			parts = append(parts, fmt.Sprint(p))
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(val)
+	}
+}
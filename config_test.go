@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestApplyConfig(t *testing.T) {
+	conf := `url: https://example.com/
+threads: 3
+ignore: [a, b]
+no-robots: true
+profiles:
+  ci:
+    url: https://staging.example.com/
+    threads: 8
+`
+
+	tests := []struct {
+		name    string
+		conf    string
+		profile string
+		args    []string
+		want    string // url, threads, ignore & no-robots, or the error
+	}{
+		{"top level", conf, "", nil, "https://example.com/ 3 a,b true"},
+		{"profile over top level", conf, "ci", nil, "https://staging.example.com/ 8 a,b true"},
+		{"command line over profile", conf, "ci", []string{"--threads", "2", "--ignore", "c"}, "https://staging.example.com/ 2 c true"},
+		{"command line false", conf, "", []string{"--no-robots=false"}, "https://example.com/ 3 a,b false"},
+		{"unknown profile", conf, "prod", nil, `profile "prod" not found in config.yml`},
+		{"unknown key", "threads: 3\nbogus: 1\n", "", nil, "invalid option in config.yml: bogus"},
+		{"unknown profile key", "profiles:\n  ci:\n    bogus: 1\n", "ci", nil, "invalid option in config.yml: bogus"},
+		{"ignored key", "profile: ci\n", "", nil, "invalid option in config.yml: profile"},
+		{"invalid value", "threads: many\n", "", nil, `invalid value for threads in config.yml: invalid argument "many" for "-t, --threads" flag: strconv.ParseInt: parsing "many": invalid syntax`},
+	}
+
+	for _, tt := range tests {
+		file := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(file, []byte(tt.conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var threads int
+		var ignore, profile string
+		var noRobots bool
+
+		flag := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		flag.IntVarP(&threads, "threads", "t", 5, "")
+		flag.StringVar(&ignore, "ignore", "", "")
+		flag.BoolVar(&noRobots, "no-robots", false, "")
+		flag.StringVar(&profile, "profile", "", "")
+		if err := flag.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+
+		startURL, err := applyConfig(flag, file, tt.profile)
+
+		got := fmt.Sprintf("%s %d %s %v", startURL, threads, ignore, noRobots)
+		if err != nil {
+			got = strings.ReplaceAll(err.Error(), file, "config.yml")
+		}
+
+		if got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
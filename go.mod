@@ -1,4 +1,4 @@
-module web-validator
+module github.com/axllent/web-validator
 
 go 1.23.0
 
@@ -10,11 +10,14 @@ require (
 	github.com/jimsmart/grobotstxt v1.0.3
 	github.com/lukasbob/srcset v0.0.0-20231122134231-06e7f27b6370
 	github.com/spf13/pflag v1.0.6
+	go.etcd.io/bbolt v1.4.3
 	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/andybalholm/cascadia v1.3.3 // indirect
 	golang.org/x/mod v0.25.0 // indirect
 	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
 )
@@ -2,42 +2,74 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"os/signal"
-	"regexp"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/axllent/ghru/v2"
+	"github.com/axllent/web-validator/validator"
 	"github.com/spf13/pflag"
 )
 
 var (
-	results          []result
 	maxDepth         int
 	checkOutbound    bool
 	validateHTML     bool
 	validateCSS      bool
 	showWarnings     bool
-	baseDomain       string
 	allLinks         bool
 	fullScan         bool
 	redirectWarnings bool
 	noRobots         bool
-	htmlValidator    = "https://validator.w3.org/nu/"
-	timeTaken        float64
+	sitemap          string
+	urlList          string
+	htmlValidator    = validator.DefaultValidator
 	update           bool
 	showVersion      bool
 	ignoreURLs       string
+	includeURLs      string
+	noFollowURLs     string
+	pathPrefix       string
+	subdomains       bool
+	aliasHosts       string
+	stripParams      string
+	sortParams       bool
+	trailingSlash    bool
+	maxURLLength     int
+	maxRepeats       int
+	maxVariants      int
+	pageCaps         string
 	timeoutSeconds   int
-	threads          chan int
+	maxPages         int
+	maxTime          int
+	failFastAfter    int
+	dialTimeout      int
+	tlsTimeout       int
+	headerTimeout    int
+	maxConnsPerHost  int
+	noHTTP2          bool
+	noCompression    bool
+	verbose          bool
+	stateDir         string
+	resume           bool
+	diskStore        bool
 	appVersion       = "dev"
-	userAgent        = "web-validator"
-	linksProcessed   = 0
-	errorsProcessed  = 0
+	reportFormat     = "text"
+	reportOutput     string
+	reportAll        bool
+	maxReportItems   int
+	failOn           = "error"
+	maxErrors        int
+	thresholds       string
+	baselineFile     string
+	baselineWrite    string
+	progressOutput   io.Writer = os.Stdout
 
 	ghruConf = ghru.Config{
 		Repo:           "axllent/web-validator",
@@ -51,14 +83,13 @@ func main() {
 
 	showHelp := false
 	var nrThreads int
-
-	userAgent = fmt.Sprintf("web-validator/%s", appVersion)
+	var configFile, profile string
 
 	flag := pflag.NewFlagSet(os.Args[0], pflag.ExitOnError)
 
 	// set the default help
 	flag.Usage = func() {
-		fmt.Printf("Usage: %s [options] <url>\n\n", os.Args[0])
+		fmt.Printf("Usage: %s [options] <url> [url...]\n\n", os.Args[0])
 		fmt.Println("Options:")
 		flag.SortFlags = false
 		flag.PrintDefaults()
@@ -70,13 +101,52 @@ func main() {
 	flag.BoolVar(&validateHTML, "html", false, "validate HTML")
 	flag.BoolVar(&validateCSS, "css", false, "validate CSS")
 	flag.StringVarP(&ignoreURLs, "ignore", "i", "", "ignore URLs, comma-separated, wildcards allowed (*.jpg,example.com)")
+	flag.StringVar(&includeURLs, "include", "", "only follow internal pages matching, comma-separated, wildcards allowed (others are only checked)")
+	flag.StringVar(&noFollowURLs, "no-follow", "", "only check internal pages matching, comma-separated, wildcards allowed (*/archive/*)")
+	flag.StringVar(&pathPrefix, "prefix", "", "only follow internal pages under this path (/docs/)")
+	flag.BoolVar(&subdomains, "subdomains", false, "treat subdomains as internal")
+	flag.StringVar(&aliasHosts, "hosts", "", "other internal hosts, comma-separated (www.example.com)")
+	flag.StringVar(&stripParams, "strip-params", "utm_*,fbclid", "remove query parameters from links, comma-separated, wildcards allowed (\"\" = none)")
+	flag.BoolVar(&sortParams, "sort-params", false, "sort the query parameters of links")
+	flag.BoolVar(&trailingSlash, "trailing-slash", false, "treat links with & without a trailing slash as the same page")
+	flag.IntVar(&maxURLLength, "max-url-length", 2000, "skip pages with longer URLs as crawler traps (0 = no limit)")
+	flag.IntVar(&maxRepeats, "max-repeats", 3, "skip pages repeating a path segment more often as crawler traps (0 = no limit)")
+	flag.IntVar(&maxVariants, "max-variants", 0, "skip pages with more query variants of the same path as crawler traps (0 = no limit)")
+	flag.StringVar(&pageCaps, "page-cap", "", "maximum pages matching patterns, comma-separated, wildcards allowed (*/calendar/*=50)")
 	flag.BoolVarP(&noRobots, "no-robots", "n", false, "ignore robots.txt (if exists)")
+	flag.StringVar(&sitemap, "sitemap", "", "also scan the pages in a sitemap `url`, reporting pages missing from it (default from robots.txt)")
+	flag.Lookup("sitemap").NoOptDefVal = validator.SitemapAuto
+	flag.StringVar(&urlList, "urls", "", "scan the URLs listed in a `file`, one per line (\"-\" for stdin)")
 	flag.BoolVarP(&redirectWarnings, "redirects", "r", false, "treat redirects as errors")
 	flag.BoolVarP(&showWarnings, "warnings", "w", false, "display validation warnings (default errors only)")
 	flag.BoolVarP(&fullScan, "full", "f", false, "full scan (same as \"-a -r -o --html --css\")")
 	flag.IntVarP(&nrThreads, "threads", "t", 5, "number of threads")
 	flag.IntVar(&timeoutSeconds, "timeout", 10, "timeout in seconds")
+	flag.IntVar(&maxPages, "max-pages", 0, "maximum number of pages to scan, further links are only checked (0 = all)")
+	flag.IntVar(&maxTime, "max-time", 0, "stop the scan after this many seconds (0 = none)")
+	flag.IntVar(&failFastAfter, "fail-fast-after", 0, "stop the scan after this many errors (0 = none)")
+	flag.IntVar(&dialTimeout, "dial-timeout", 30, "connect timeout in seconds")
+	flag.IntVar(&tlsTimeout, "tls-timeout", 10, "TLS handshake timeout in seconds")
+	flag.IntVar(&headerTimeout, "header-timeout", 0, "response header timeout in seconds (0 = none)")
+	flag.IntVar(&maxConnsPerHost, "max-idle-conns", 0, "idle connections kept per host (default threads)")
+	flag.BoolVar(&noHTTP2, "no-http2", false, "disable HTTP/2")
+	flag.BoolVar(&noCompression, "no-compression", false, "disable gzip compression")
 	flag.StringVar(&htmlValidator, "validator", htmlValidator, "Nu Html validator")
+	flag.StringVar(&reportFormat, "format", reportFormat, "report format (text, json, junit, sarif, html, csv, markdown, github, ndjson)")
+	flag.StringVar(&reportOutput, "output", "", "write the report to a file (default stdout)")
+	flag.BoolVar(&reportAll, "report-all", false, "include successful URLs in the report (json, csv)")
+	flag.IntVar(&maxReportItems, "max-items", 0, "maximum number of failing URLs in the report (markdown, github, 0 = all)")
+	flag.StringVar(&failOn, "fail-on", failOn, "exit with an error on problems of this level (error, warning, none)")
+	flag.IntVar(&maxErrors, "max-errors", 0, "number of problems allowed before exiting with an error")
+	flag.StringVar(&thresholds, "threshold", "", "maximum problems per category, comma-separated (broken-link=0,validation=20)")
+	flag.StringVar(&baselineFile, "baseline", "", "ignore known problems listed in a baseline file")
+	flag.StringVar(&baselineWrite, "baseline-write", "", "write all problems to a baseline file")
+	flag.StringVar(&stateDir, "state", "", "save checkpoints of the scan to a directory")
+	flag.BoolVar(&resume, "resume", false, "resume an interrupted scan from the --state directory")
+	flag.BoolVar(&diskStore, "disk", false, "keep the scan state on disk rather than in memory (in --state dir if set)")
+	flag.BoolVar(&verbose, "verbose", false, "display connection statistics")
+	flag.StringVarP(&configFile, "config", "c", "", "config file (default .web-validator.yml if exists)")
+	flag.StringVarP(&profile, "profile", "p", "", "config file profile")
 	flag.BoolVarP(&update, "update", "u", false, "update to latest release")
 	flag.BoolVarP(&showVersion, "version", "v", false, "show app version")
 	flag.BoolVarP(&showHelp, "help", "h", false, "show help")
@@ -132,38 +202,88 @@ func main() {
 		os.Exit(0)
 	}
 
-	if len(args) != 1 {
-		fmt.Println("web-validator: missing URL")
-		fmt.Printf("Try `%s -h` for more options.\n", os.Args[0])
+	if configFile == "" {
+		configFile = findConfigFile()
+	}
+
+	configURL := ""
+
+	if configFile != "" {
+		var err error
+		configURL, err = applyConfig(flag, configFile, profile)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(2)
+		}
+	} else if profile != "" {
+		fmt.Println("A profile requires a config file")
 		os.Exit(2)
 	}
 
-	if htmlValidator != "" {
-		u, err := url.Parse(htmlValidator)
+	if urlList != "" {
+		urls, err := readURLList(urlList)
 		if err != nil {
-			fmt.Printf("Invalid Nu validator address: %s\n", htmlValidator)
+			fmt.Printf("Error reading URLs: %s\n", err)
 			os.Exit(2)
 		}
+		args = append(args, urls...)
+	}
 
-		q := u.Query()
-		// add `?out=json`
-		q.Set("out", "json")
-		u.RawQuery = q.Encode()
-		htmlValidator = u.String()
+	// "--sitemap <url>" sets the default sitemap, making the url a start URL
+	if sitemap == validator.SitemapAuto {
+		if s := sitemapArg(flag.Args()); s != "" {
+			fmt.Printf("A sitemap URL must be set with --sitemap=%s\n", s)
+			os.Exit(2)
+		}
 	}
 
-	if ignoreURLs != "" {
-		// create slice of ignore strings converting them to regex
-		urls := strings.Split(ignoreURLs, ",")
-		for _, u := range urls {
-			filter := strings.ReplaceAll(u, "*", "WILDCARD_CHARACTER_HERE")
-			filter = regexp.QuoteMeta(filter)
-			filter = strings.ReplaceAll(filter, "WILDCARD_CHARACTER_HERE", "(.*)")
-			re := regexp.MustCompile(filter)
-			ignoreMatches = append(ignoreMatches, re)
+	if len(args) == 0 && configURL != "" {
+		args = []string{configURL}
+	}
+
+	if len(args) == 0 {
+		fmt.Println("web-validator: missing URL")
+		fmt.Printf("Try `%s -h` for more options.\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	switch reportFormat {
+	case "text", "json", "junit", "sarif", "html", "csv", "markdown", "github", "ndjson":
+	default:
+		fmt.Printf("Invalid report format: %s\n", reportFormat)
+		os.Exit(2)
+	}
+
+	switch failOn {
+	case "error", "warning", "none":
+	default:
+		fmt.Printf("Invalid --fail-on level: %s\n", failOn)
+		os.Exit(2)
+	}
+
+	if resume && stateDir == "" {
+		fmt.Println("--resume requires a --state directory")
+		os.Exit(2)
+	}
+
+	if err := parseThresholds(thresholds); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(2)
+	}
+
+	if baselineFile != "" {
+		if err := loadBaseline(baselineFile); err != nil {
+			fmt.Printf("Error loading baseline: %s\n", err)
+			os.Exit(2)
 		}
 	}
 
+	// keep progress out of stdout when it is used for machine-readable output,
+	// workflow commands are only recognised at the start of a line
+	if reportFormat != "text" && reportOutput == "" {
+		progressOutput = os.Stderr
+	}
+
 	if fullScan {
 		maxDepth = -1
 		checkOutbound = true
@@ -176,42 +296,235 @@ func main() {
 		maxDepth = -1
 	}
 
-	u, err := url.Parse(args[0])
-	if err != nil || u.Host == "" {
-		fmt.Printf("Please use a full URL: %s\n", args[0])
-		os.Exit(2)
+	opts := validator.Options{
+		URL:                   args[0],
+		URLs:                  args[1:],
+		MaxDepth:              maxDepth,
+		CheckOutbound:         checkOutbound,
+		ValidateHTML:          validateHTML,
+		ValidateCSS:           validateCSS,
+		ShowWarnings:          showWarnings,
+		RedirectWarnings:      redirectWarnings,
+		NoRobots:              noRobots,
+		PathPrefix:            pathPrefix,
+		Subdomains:            subdomains,
+		SortParams:            sortParams,
+		TrailingSlash:         trailingSlash,
+		MaxURLLength:          maxURLLength,
+		MaxRepeats:            maxRepeats,
+		MaxVariants:           maxVariants,
+		Sitemap:               sitemap,
+		Validator:             htmlValidator,
+		Threads:               nrThreads,
+		Timeout:               time.Duration(timeoutSeconds) * time.Second,
+		MaxPages:              maxPages,
+		MaxTime:               time.Duration(maxTime) * time.Second,
+		FailFastAfter:         failFastAfter,
+		DialTimeout:           time.Duration(dialTimeout) * time.Second,
+		TLSHandshakeTimeout:   time.Duration(tlsTimeout) * time.Second,
+		ResponseHeaderTimeout: time.Duration(headerTimeout) * time.Second,
+		MaxIdleConnsPerHost:   maxConnsPerHost,
+		DisableHTTP2:          noHTTP2,
+		DisableCompression:    noCompression,
+		StateDir:              stateDir,
+		Resume:                resume,
+		DiskStore:             diskStore,
+		UserAgent:             fmt.Sprintf("web-validator/%s", appVersion),
+		OnProgress: func(link string, linksProcessed, errorsProcessed int) {
+			fmt.Fprintf(progressOutput, "\033[2K\r#%-3d (%d errors) %s", linksProcessed, errorsProcessed, truncateString(link, 100))
+		},
 	}
 
-	initRobotsTxt(args[0])
+	if ignoreURLs != "" {
+		opts.Ignore = strings.Split(ignoreURLs, ",")
+	}
 
-	threads = make(chan int, nrThreads)
+	if includeURLs != "" {
+		opts.Include = strings.Split(includeURLs, ",")
+	}
 
-	start := time.Now()
+	if noFollowURLs != "" {
+		opts.NoFollow = strings.Split(noFollowURLs, ",")
+	}
 
-	var wg sync.WaitGroup
+	if aliasHosts != "" {
+		opts.Hosts = strings.Split(aliasHosts, ",")
+	}
 
-	addQueueLink(args[0], "parse", "", 0, &wg)
+	if stripParams != "" {
+		opts.StripParams = strings.Split(stripParams, ",")
+	}
 
-	// display results if process is cancelled (ctrl-c)
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		for range c {
-			elapsed := time.Since(start)
+	if pageCaps != "" {
+		caps, err := parsePageCaps(pageCaps)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(2)
+		}
+		opts.PageCaps = caps
+	}
+
+	if failFastAfter > 0 && len(baselineKeys) > 0 {
+		opts.FailFastIssues = failFastIssues()
+	}
+
+	if reportFormat == "ndjson" {
+		opts.OnResult = streamResult
+	}
+
+	crawler, err := validator.New(opts)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(2)
+	}
 
-			timeTaken = elapsed.Round(time.Second).Seconds()
-			fmt.Println("")
-			fmt.Println("Process interrupted")
-			displayReport(results)
+	if reportFormat == "ndjson" {
+		if err := startStream(args); err != nil {
+			fmt.Println(err.Error())
 			os.Exit(1)
 		}
-	}()
+	}
 
-	wg.Wait()
+	// stop the crawl & display results if process is cancelled (ctrl-c)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	elapsed := time.Since(start)
+	crawl, err := crawler.Run(ctx)
+	if crawl == nil {
+		fmt.Println(err.Error())
+		os.Exit(2)
+	}
+
+	code := reportCrawl(crawl, err)
+
+	// remove the temporary disk store
+	if err := crawl.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
 
-	timeTaken = elapsed.Round(time.Second).Seconds()
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+// Write the report & baseline of the crawl, returning the exit code
+func reportCrawl(crawl *validator.Report, err error) int {
+	if crawl.Interrupted {
+		fmt.Fprintln(progressOutput, "")
+		fmt.Fprintln(progressOutput, "Process interrupted")
+		if stateDir != "" {
+			fmt.Fprintf(progressOutput, "Run with `--state %s --resume` to continue\n", stateDir)
+		}
+		if err := applyBaseline(crawl); err != nil {
+			fmt.Println(err.Error())
+		}
+		if err := writeReport(crawl); err != nil {
+			fmt.Println(err.Error())
+		}
+		return 1
+	}
+
+	if err != nil {
+		// the crawl failed (store or checkpoint error), the report of what
+		// was scanned is written but the scan fails whatever the thresholds
+		fmt.Fprintln(os.Stderr, err.Error())
+		if err := applyBaseline(crawl); err != nil {
+			fmt.Println(err.Error())
+		}
+		if err := writeReport(crawl); err != nil {
+			fmt.Println(err.Error())
+		}
+		return 2
+	}
+
+	if baselineWrite != "" {
+		if err := writeBaseline(baselineWrite, crawl); err != nil {
+			fmt.Println(err.Error())
+			return 1
+		}
+	}
+
+	if err := applyBaseline(crawl); err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+
+	if err := writeReport(crawl); err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+
+	if verbose {
+		displayConnStats(crawl.Connections)
+	}
+
+	reasons, err := failedThresholds(crawl)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+
+	if len(reasons) > 0 {
+		for _, r := range reasons {
+			fmt.Fprintf(os.Stderr, "Failed: %s\n", r)
+		}
+		return 1
+	}
+
+	return 0
+}
+
+// Truncate a string
+func truncateString(str string, num int) string {
+	ts := str
+	if len(str) > num {
+		if num > 3 {
+			num -= 3
+		}
+		ts = str[0:num] + "..."
+	}
+	return ts
+}
+
+// Parse comma-separated page caps, eg: */calendar/*=50,*/search*=100
+func parsePageCaps(s string) (map[string]int, error) {
+	caps := make(map[string]int)
+
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+
+		// patterns may contain "=", the cap is after the last one
+		i := strings.LastIndex(c, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid page cap: %s", c)
+		}
+
+		max, err := strconv.Atoi(strings.TrimSpace(c[i+1:]))
+		if err != nil || max < 1 {
+			return nil, fmt.Errorf("invalid page cap: %s", c)
+		}
+
+		caps[strings.TrimSpace(c[:i])] = max
+	}
+
+	return caps, nil
+}
+
+// Return the first argument which is a sitemap URL, if any
+func sitemapArg(args []string) string {
+	for _, a := range args {
+		u, err := url.Parse(a)
+		if err != nil {
+			continue
+		}
+
+		if strings.HasSuffix(u.Path, ".xml") || strings.HasSuffix(u.Path, ".xml.gz") {
+			return a
+		}
+	}
 
-	displayReport(results)
+	return ""
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParsePageCaps(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // the caps, or the error
+	}{
+		{"", "map[]"},
+		{"*/calendar/*=50", "map[*/calendar/*:50]"},
+		{" */calendar/* = 50 , */search*=100,", "map[*/calendar/*:50 */search*:100]"},
+		{"*/search?q=*=10", "map[*/search?q=*:10]"},
+		{"*/calendar/*", "invalid page cap: */calendar/*"},
+		{"=50", "invalid page cap: =50"},
+		{"*/calendar/*=0", "invalid page cap: */calendar/*=0"},
+		{"*/calendar/*=many", "invalid page cap: */calendar/*=many"},
+	}
+
+	for _, tt := range tests {
+		caps, err := parsePageCaps(tt.in)
+
+		got := fmt.Sprint(caps)
+		if err != nil {
+			got = err.Error()
+		}
+
+		if got != tt.want {
+			t.Errorf("%q: expected %s, got %s", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestSitemapArg(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"https://example.com/"}, ""},
+		{[]string{"https://example.com/feed.xml.html"}, ""},
+		{[]string{"https://example.com/sitemap.xml", "https://example.com/"}, "https://example.com/sitemap.xml"},
+		{[]string{"https://example.com/", "https://example.com/sitemap.xml.gz?v=2"}, "https://example.com/sitemap.xml.gz?v=2"},
+	}
+
+	for _, tt := range tests {
+		if got := sitemapArg(tt.args); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.args, tt.want, got)
+		}
+	}
+}
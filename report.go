@@ -2,53 +2,198 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"strings"
+
+	"github.com/axllent/web-validator/validator"
 )
 
-func displayReport(results []result) {
-	fmt.Printf("\033[2K\rScanned: %d links\nErrors:  %d\nTime:    %vs\n\n", linksProcessed, errorsProcessed, timeTaken)
+// Report struct. The results are read from the crawl one at a time, so the
+// results of a --disk scan are never all held in memory.
+type report struct {
+	LinksProcessed    int     `json:"linksProcessed"`
+	ErrorsProcessed   int     `json:"errorsProcessed"`
+	WarningsProcessed int     `json:"warningsProcessed"`
+	NoticesProcessed  int     `json:"noticesProcessed"`
+	TimeTaken         float64 `json:"timeTaken"`
+	Interrupted       bool    `json:"interrupted,omitempty"`
+	Truncated         string  `json:"truncated,omitempty"`
+	Suppressed        int     `json:"suppressed,omitempty"`
+
+	crawl *validator.Report
+	all   bool // include successful URLs
+}
+
+// Return a report of the crawl, only including successful URLs if all == true
+func newReport(crawl *validator.Report, all bool) report {
+	return report{
+		LinksProcessed:    crawl.LinksProcessed,
+		ErrorsProcessed:   crawl.ErrorsProcessed,
+		WarningsProcessed: crawl.WarningsProcessed,
+		NoticesProcessed:  crawl.NoticesProcessed,
+		TimeTaken:         crawl.TimeTaken,
+		Interrupted:       crawl.Interrupted,
+		Truncated:         crawl.Truncated,
+		Suppressed:        suppressedProblems,
+		crawl:             crawl,
+		all:               all,
+	}
+}
+
+// Call fn for each result of the report, without the issues known in the
+// baseline
+func (rpt report) each(fn func(r validator.Result) error) error {
+	remaining := baselineRemaining()
+
+	return rpt.crawl.EachResult(func(r validator.Result) error {
+		filterBaseline(&r, remaining)
+
+		if !rpt.all && !hasProblems(r) {
+			return nil
+		}
+
+		return fn(r)
+	})
+}
+
+// Return the referrers of a URL, nil if it was not linked
+func (rpt report) referrers(link string) ([]string, error) {
+	return rpt.crawl.ReferrersOf(link)
+}
+
+// Return the original hrefs of a URL
+func (rpt report) hrefs(link string) ([]string, error) {
+	return rpt.crawl.HrefsOf(link)
+}
+
+// Write the report in the selected format to stdout, or the output file if set
+func writeReport(crawl *validator.Report) error {
+	// clear the progress line
+	fmt.Fprint(progressOutput, "\033[2K\r")
+
+	// results have already been streamed during the crawl
+	if reportFormat == "ndjson" {
+		return finishStream(crawl)
+	}
+
+	var w io.Writer = os.Stdout
 
-	for _, r := range results {
-		if r.StatusCode == 200 && len(r.Errors) == 0 && len(r.ValidationErrors) == 0 && r.Redirect == "" {
-			continue
+	if reportOutput != "" {
+		f, err := os.Create(reportOutput)
+		if err != nil {
+			return err
 		}
 
-		fmt.Printf("---\n\n")
+		defer func() { _ = f.Close() }()
+
+		w = f
+	}
+
+	switch reportFormat {
+	case "json":
+		return writeJSONReport(w, newReport(crawl, reportAll))
+	case "sarif":
+		return writeSARIFReport(w, newReport(crawl, false))
+	case "html":
+		return writeHTMLReport(w, newReport(crawl, false))
+	case "csv":
+		return writeCSVReport(w, newReport(crawl, reportAll))
+	case "markdown":
+		return writeMarkdownReport(w, newReport(crawl, false))
+	case "github":
+		return writeGitHubReport(w, newReport(crawl, false))
+	case "junit":
+		// every URL is a testcase
+		return writeJUnitReport(w, newReport(crawl, true))
+	default:
+		return displayReport(w, newReport(crawl, reportAll))
+	}
+}
+
+// Whether a result has anything to report
+func hasProblems(r validator.Result) bool {
+	return len(r.Issues) > 0
+}
+
+// Display how many connections were reused
+func displayConnStats(stats validator.ConnStats) {
+	total := stats.New + stats.Reused
+	if total == 0 {
+		return
+	}
+
+	fmt.Fprintf(progressOutput, "Connections: %d new, %d reused (%d%% of requests)\n", stats.New, stats.Reused, stats.Reused*100/total)
+}
+
+func displayReport(w io.Writer, rpt report) error {
+	fmt.Fprintf(w, "Scanned: %d links\nErrors:  %d\n", rpt.LinksProcessed, rpt.ErrorsProcessed)
+	if rpt.WarningsProcessed > 0 || rpt.NoticesProcessed > 0 {
+		fmt.Fprintf(w, "Other:   %d warnings, %d notices\n", rpt.WarningsProcessed, rpt.NoticesProcessed)
+	}
+	if rpt.Suppressed > 0 {
+		fmt.Fprintf(w, "Known:   %d (baseline)\n", rpt.Suppressed)
+	}
+	fmt.Fprintf(w, "Time:    %vs\n", rpt.TimeTaken)
+	if rpt.Truncated != "" {
+		fmt.Fprintf(w, "Stopped: --%s reached\n", rpt.Truncated)
+	}
+	fmt.Fprintln(w, "")
+
+	return rpt.each(func(r validator.Result) error {
+		if !hasProblems(r) {
+			return nil
+		}
+
+		fmt.Fprintf(w, "---\n\n")
 
 		if r.Redirect != "" {
-			fmt.Printf("Link:    %s => %s\n", r.URL, r.Redirect)
+			fmt.Fprintf(w, "Link:    %s => %s\n", r.URL, r.Redirect)
 		} else {
-			fmt.Printf("Link:    %s\n", r.URL)
+			fmt.Fprintf(w, "Link:    %s\n", r.URL)
 		}
 
 		if r.StatusCode > 0 {
-			fmt.Printf("Status:  %d (%s)\n", r.StatusCode, http.StatusText(r.StatusCode))
+			fmt.Fprintf(w, "Status:  %d (%s)\n", r.StatusCode, http.StatusText(r.StatusCode))
+		}
+
+		refs, err := rpt.referrers(r.URL)
+		if err != nil {
+			return err
 		}
 
-		if len(referrers[r.URL]) > 0 {
-			if len(referrers[r.URL]) > 3 {
-				fmt.Printf("Refs:    %s ... (%dx)\n", strings.Join(referrers[r.URL][0:3], "\n         "), len(referrers[r.URL]))
+		if len(refs) > 0 {
+			if len(refs) > 3 {
+				fmt.Fprintf(w, "Refs:    %s ... (%dx)\n", strings.Join(refs[0:3], "\n         "), len(refs))
 			} else {
-				fmt.Printf("Refs:    %s\n", strings.Join(referrers[r.URL], "\n         "))
+				fmt.Fprintf(w, "Refs:    %s\n", strings.Join(refs, "\n         "))
 			}
 		}
 
-		if len(r.Errors) > 0 || len(r.ValidationErrors) > 0 {
-			fmt.Println("Errors:")
+		hrefs, err := rpt.hrefs(r.URL)
+		if err != nil {
+			return err
 		}
 
-		errorNr := 0
-
-		for _, e := range r.Errors {
-			errorNr++
-			fmt.Printf("  %4d)  [error] %s\n", errorNr, e)
+		if len(hrefs) > 0 {
+			fmt.Fprintf(w, "Hrefs:   %s\n", strings.Join(hrefs, "\n         "))
 		}
-		for _, e := range r.ValidationErrors {
-			errorNr++
-			fmt.Printf("  %4d)  [#%d] (%s) %s\n", errorNr, e.LastLine, e.Type, strings.TrimSpace(e.Message))
+
+		fmt.Fprintln(w, "Errors:")
+
+		for n, i := range r.Issues {
+			if i.Validation != nil {
+				fmt.Fprintf(w, "  %4d)  [#%d] (%s) %s\n", n+1, i.Validation.LastLine, i.Severity, i.Message)
+			} else if i.Skipped > 0 {
+				fmt.Fprintf(w, "  %4d)  [%s] %s (%d links)\n", n+1, i.Severity, i.Message, i.Skipped)
+			} else {
+				fmt.Fprintf(w, "  %4d)  [%s] %s\n", n+1, i.Severity, i.Message)
+			}
 		}
 
-		fmt.Println("")
-	}
+		fmt.Fprintln(w, "")
+
+		return nil
+	})
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+// Write the report as CSV, one row per URL, referrer & issue. A scan which
+// stopped early ends with a "truncated" row.
+func writeCSVReport(w io.Writer, rpt report) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"url", "referrer", "status", "redirect", "category", "code", "severity", "target", "message", "line"}); err != nil {
+		return err
+	}
+
+	err := rpt.each(func(r validator.Result) error {
+		refs, err := rpt.referrers(r.URL)
+		if err != nil {
+			return err
+		}
+		if len(refs) == 0 {
+			// the start URL has no referrers
+			refs = []string{""}
+		}
+
+		status := ""
+		if r.StatusCode > 0 {
+			status = strconv.Itoa(r.StatusCode)
+		}
+
+		issues := r.Issues
+		if len(issues) == 0 {
+			// successful URLs are only included with --report-all
+			issues = []validator.Issue{{}}
+		}
+
+		for _, i := range issues {
+			line := ""
+			if i.Validation != nil && i.Validation.LastLine > 0 {
+				line = strconv.Itoa(i.Validation.LastLine)
+			}
+
+			for _, ref := range refs {
+				if err := cw.Write([]string{r.URL, ref, status, r.Redirect, i.Category, i.Code, i.Severity, i.Target, i.Message, line}); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if rpt.Truncated != "" {
+		msg := fmt.Sprintf("the scan stopped early (--%s reached)", rpt.Truncated)
+		if err := cw.Write([]string{"", "", "", "", "", "truncated", validator.SeverityWarning, "", msg, ""}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
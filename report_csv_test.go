@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+func TestWriteCSVReport(t *testing.T) {
+	crawl := &validator.Report{
+		Truncated: validator.TruncatedMaxPages,
+		Results: []validator.Result{
+			{URL: "https://example.com/", Type: "parse", StatusCode: 200},
+			{URL: "https://example.com/a", StatusCode: 404, Issues: []validator.Issue{
+				{Code: "broken-link", Severity: validator.SeverityError, Category: "broken-link", Target: "https://example.com/a", Message: "returned status 404"},
+				{Code: "sitemap-broken", Severity: validator.SeverityError, Category: "sitemap", Source: "https://example.com/sitemap.xml", Target: "https://example.com/a", Message: "listed in the sitemap"},
+			}},
+		},
+		Referrers: map[string][]string{"https://example.com/a": {"https://example.com/", "https://example.com/b"}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeCSVReport(&buf, newReport(crawl, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, row := range rows {
+		got = append(got, row[0]+" "+row[1]+" "+row[5])
+	}
+
+	// a row per referrer & issue, without the successful URL, then the truncated row
+	want := []string{
+		"url referrer code",
+		"https://example.com/a https://example.com/ broken-link",
+		"https://example.com/a https://example.com/b broken-link",
+		"https://example.com/a https://example.com/ sitemap-broken",
+		"https://example.com/a https://example.com/b sitemap-broken",
+		"  truncated",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
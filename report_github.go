@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+// Write the report as GitHub Actions workflow commands, followed by the
+// text report. The Markdown report is appended to $GITHUB_STEP_SUMMARY if set.
+func writeGitHubReport(w io.Writer, rpt report) error {
+	err := rpt.each(func(r validator.Result) error {
+		for _, i := range r.Issues {
+			props := []string{"title=" + ghEscapeProperty(fmt.Sprintf("%s: %s", i.Code, r.URL))}
+
+			if v := i.Validation; v != nil && v.LastLine > 0 {
+				props = append(props,
+					"file="+ghEscapeProperty(r.URL),
+					fmt.Sprintf("line=%d", v.FirstLine),
+					fmt.Sprintf("endLine=%d", v.LastLine),
+					fmt.Sprintf("col=%d", v.FirstColumn),
+					fmt.Sprintf("endColumn=%d", v.LastColumn),
+				)
+			}
+
+			// severities match the workflow command names
+			if _, err := fmt.Fprintf(w, "::%s %s::%s\n", i.Severity, strings.Join(props, ","), ghEscapeData(i.Message)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := displayReport(w, rpt); err != nil {
+		return err
+	}
+
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = f.Close() }()
+
+	return writeMarkdownReport(f, rpt)
+}
+
+// Escape workflow command data
+func ghEscapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(strings.TrimSpace(s))
+}
+
+// Escape workflow command property values
+func ghEscapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+func TestWriteGitHubReport(t *testing.T) {
+	crawl := &validator.Report{
+		Results: []validator.Result{
+			{URL: "https://example.com/", Type: "parse", StatusCode: 200, Issues: []validator.Issue{
+				{Code: "html-validation", Severity: validator.SeverityError, Category: "validation", Message: "Stray end tag", Validation: &validator.ValidationError{
+					FirstLine: 3, LastLine: 4, FirstColumn: 9, LastColumn: 12,
+				}},
+				{Code: "sitemap-missing", Severity: validator.SeverityWarning, Category: "sitemap", Message: "page is not listed\nin the sitemap"},
+			}},
+		},
+	}
+
+	// the summary is appended to
+	summary := filepath.Join(t.TempDir(), "summary.md")
+	if err := os.WriteFile(summary, []byte("previous step\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GITHUB_STEP_SUMMARY", summary)
+
+	var buf bytes.Buffer
+	if err := writeGitHubReport(&buf, newReport(crawl, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	// validation issues are located, properties & data escaped
+	for _, want := range []string{
+		"::error title=html-validation%3A https%3A//example.com/,file=https%3A//example.com/,line=3,endLine=4,col=9,endColumn=12::Stray end tag\n",
+		"::warning title=sitemap-missing%3A https%3A//example.com/::page is not listed%0Ain the sitemap\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q, got\n%s", want, buf.String())
+		}
+	}
+
+	b, err := os.ReadFile(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "previous step\n## Web-validator report\n") || !strings.Contains(string(b), "https://example.com/") {
+		t.Errorf("expected the Markdown report appended to the summary, got\n%s", b)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+// HTML report row, one per result
+type htmlRow struct {
+	URL        string
+	Redirect   string
+	StatusCode int
+	Status     string
+	Referrers  []string
+	Issues     []htmlIssue
+	Categories string
+}
+
+// HTML report issue
+type htmlIssue struct {
+	Code     string
+	Severity string
+	Message  string
+	Line     int
+	Column   int
+	// the validation extract split around the highlighted span
+	Before string
+	Hilite string
+	After  string
+}
+
+// Write the report as a single self-contained HTML file, one row at a time
+func writeHTMLReport(w io.Writer, rpt report) error {
+	tmpl, err := template.New("report").Parse(htmlReportTemplate)
+	if err != nil {
+		return err
+	}
+
+	page := struct {
+		Report     report
+		Categories []string
+		Version    string
+	}{rpt, validator.IssueCategories, appVersion}
+
+	if err := tmpl.ExecuteTemplate(w, "head", page); err != nil {
+		return err
+	}
+
+	err = rpt.each(func(r validator.Result) error {
+		refs, err := rpt.referrers(r.URL)
+		if err != nil {
+			return err
+		}
+
+		row := htmlRow{
+			URL:        r.URL,
+			Redirect:   r.Redirect,
+			StatusCode: r.StatusCode,
+			Status:     http.StatusText(r.StatusCode),
+			Referrers:  refs,
+		}
+
+		categories := []string{}
+
+		for _, i := range r.Issues {
+			hi := htmlIssue{
+				Code:     i.Code,
+				Severity: i.Severity,
+				Message:  i.Message,
+			}
+
+			if v := i.Validation; v != nil {
+				hi.Line = v.FirstLine
+				hi.Column = v.FirstColumn
+				hi.Before, hi.Hilite, hi.After = splitExtract(v.Extract, v.HiliteStart, v.HiliteLength)
+			}
+
+			row.Issues = append(row.Issues, hi)
+
+			if !slices.Contains(categories, i.Category) {
+				categories = append(categories, i.Category)
+			}
+		}
+
+		row.Categories = strings.Join(categories, " ")
+
+		return tmpl.ExecuteTemplate(w, "row", row)
+	})
+	if err != nil {
+		return err
+	}
+
+	return tmpl.ExecuteTemplate(w, "foot", page)
+}
+
+// Split a validation extract into the text before, within and after the highlighted span
+func splitExtract(extract string, start, length int) (string, string, string) {
+	runes := []rune(extract)
+
+	if start < 0 || length <= 0 || start >= len(runes) {
+		return extract, "", ""
+	}
+
+	end := start + length
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	return string(runes[:start]), string(runes[start:end]), string(runes[end:])
+}
+
+const htmlReportTemplate = `{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Web-validator report</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; vertical-align: top; padding: .4em .6em; border-bottom: 1px solid #ddd; }
+th { cursor: pointer; background: #f4f4f4; user-select: none; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+.summary td { border: 0; padding: .1em 1em .1em 0; }
+.filters { margin: 1.5em 0 1em; }
+.filters input { width: 30em; max-width: 100%; }
+ul { margin: 0; padding-left: 1.2em; }
+.error { color: #b00020; }
+.warning { color: #a05a00; }
+.notice { color: #555; }
+.code { font-size: .8em; background: #eee; border-radius: 3px; padding: 0 .3em; }
+pre { white-space: pre-wrap; background: #f8f8f8; padding: .3em; margin: .3em 0; }
+mark { background: #ffd54f; }
+</style>
+</head>
+<body>
+<h1>Web-validator report</h1>
+<table class="summary">
+<tr><td>Scanned:</td><td>{{.Report.LinksProcessed}} links</td></tr>
+<tr><td>Errors:</td><td>{{.Report.ErrorsProcessed}}</td></tr>
+<tr><td>Time:</td><td>{{.Report.TimeTaken}}s</td></tr>
+{{if .Report.Truncated}}<tr><td>Stopped:</td><td>--{{.Report.Truncated}} reached</td></tr>
+{{end}}</table>
+<div class="filters">
+<input type="search" id="filter" placeholder="Filter by URL or message">
+<select id="category">
+<option value="">All categories</option>
+{{range .Categories}}<option value="{{.}}">{{.}}</option>
+{{end}}</select>
+<span id="count"></span>
+</div>
+<table id="results">
+<thead>
+<tr><th data-type="text">Link</th><th data-type="number">Status</th><th data-type="number">Issues</th><th data-type="number">Referrers</th></tr>
+</thead>
+<tbody>
+{{end}}{{define "row"}}<tr data-categories="{{.Categories}}">
+<td data-sort="{{.URL}}"><a href="{{.URL}}">{{.URL}}</a>{{if .Redirect}} &rArr; <a href="{{.Redirect}}">{{.Redirect}}</a>{{end}}
+<ul>
+{{range .Issues}}<li class="{{.Severity}}"><span class="code">{{.Code}}</span> {{if .Line}}[#{{.Line}}:{{.Column}}] {{end}}{{.Message}}{{if or .Before .Hilite .After}}<pre>{{.Before}}<mark>{{.Hilite}}</mark>{{.After}}</pre>{{end}}</li>
+{{end}}</ul>
+</td>
+<td data-sort="{{.StatusCode}}">{{if .StatusCode}}{{.StatusCode}} {{.Status}}{{end}}</td>
+<td data-sort="{{len .Issues}}">{{len .Issues}}</td>
+<td data-sort="{{len .Referrers}}">{{if .Referrers}}<details><summary>{{len .Referrers}}</summary><ul>
+{{range .Referrers}}<li><a href="{{.}}">{{.}}</a></li>
+{{end}}</ul></details>{{end}}</td>
+</tr>
+{{end}}{{define "foot"}}</tbody>
+</table>
+<p class="note">Generated by web-validator {{.Version}}</p>
+<script>
+(function () {
+	var table = document.getElementById("results");
+	var body = table.tBodies[0];
+	var filter = document.getElementById("filter");
+	var category = document.getElementById("category");
+	var count = document.getElementById("count");
+
+	function applyFilter() {
+		var q = filter.value.toLowerCase();
+		var c = category.value;
+		var shown = 0;
+		Array.prototype.forEach.call(body.rows, function (row) {
+			var ok = (!q || row.textContent.toLowerCase().indexOf(q) !== -1) &&
+				(!c || (" " + row.dataset.categories + " ").indexOf(" " + c + " ") !== -1);
+			row.style.display = ok ? "" : "none";
+			if (ok) { shown++; }
+		});
+		count.textContent = shown + " of " + body.rows.length;
+	}
+
+	Array.prototype.forEach.call(table.tHead.rows[0].cells, function (th, i) {
+		th.addEventListener("click", function () {
+			var asc = !th.classList.contains("asc");
+			Array.prototype.forEach.call(th.parentNode.cells, function (c) { c.classList.remove("asc", "desc"); });
+			th.classList.add(asc ? "asc" : "desc");
+			var rows = Array.prototype.slice.call(body.rows);
+			rows.sort(function (a, b) {
+				var x = a.cells[i].dataset.sort, y = b.cells[i].dataset.sort;
+				var c = th.dataset.type === "number" ? x - y : x.localeCompare(y);
+				return asc ? c : -c;
+			});
+			rows.forEach(function (row) { body.appendChild(row); });
+		});
+	});
+
+	filter.addEventListener("input", applyFilter);
+	category.addEventListener("change", applyFilter);
+	applyFilter();
+})();
+</script>
+</body>
+</html>
+{{end}}`
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+func TestWriteHTMLReport(t *testing.T) {
+	crawl := &validator.Report{
+		Results: []validator.Result{
+			{URL: "https://example.com/", Type: "parse", StatusCode: 200, Issues: []validator.Issue{
+				{Code: "html-validation", Severity: validator.SeverityError, Category: "validation", Message: "Stray end tag", Validation: &validator.ValidationError{
+					FirstLine: 3, LastLine: 3, FirstColumn: 9, LastColumn: 12, Extract: "<p>Héllo</b> world", HiliteStart: 8, HiliteLength: 4,
+				}},
+			}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeHTMLReport(&buf, newReport(crawl, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the highlighted span of the extract is marked & escaped, counted in characters
+	for _, want := range []string{
+		`[#3:9] Stray end tag`,
+		`<pre>&lt;p&gt;Héllo<mark>&lt;/b&gt;</mark> world</pre>`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %s, got\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestSplitExtract(t *testing.T) {
+	tests := []struct {
+		extract       string
+		start, length int
+		want          string
+	}{
+		{"<p>Hello</b>", 8, 4, "<p>Hello|</b>|"},
+		{"<p>Hello</b>", 8, 10, "<p>Hello|</b>|"},
+		{"<p>Hello</b>", 20, 4, "<p>Hello</b>||"},
+		{"<p>Hello</b>", 2, 0, "<p>Hello</b>||"},
+	}
+
+	for _, tt := range tests {
+		before, hilite, after := splitExtract(tt.extract, tt.start, tt.length)
+		if got := before + "|" + hilite + "|" + after; got != tt.want {
+			t.Errorf("%q %d %d: expected %q, got %q", tt.extract, tt.start, tt.length, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+// Write the report as indented JSON. The results, referrers & hrefs are
+// streamed, so they are never all held in memory.
+func writeJSONReport(w io.Writer, rpt report) error {
+	doc := newJSONWriter(w, false)
+
+	doc.open("", '{')
+	doc.value("linksProcessed", rpt.LinksProcessed)
+	doc.value("errorsProcessed", rpt.ErrorsProcessed)
+	doc.value("warningsProcessed", rpt.WarningsProcessed)
+	doc.value("noticesProcessed", rpt.NoticesProcessed)
+	doc.value("timeTaken", rpt.TimeTaken)
+	if rpt.Interrupted {
+		doc.value("interrupted", rpt.Interrupted)
+	}
+	if rpt.Truncated != "" {
+		doc.value("truncated", rpt.Truncated)
+	}
+	if rpt.Suppressed > 0 {
+		doc.value("suppressed", rpt.Suppressed)
+	}
+
+	doc.open("results", '[')
+	if err := rpt.each(func(r validator.Result) error {
+		doc.value("", r)
+		return doc.err
+	}); err != nil {
+		return err
+	}
+	doc.close()
+
+	// list the referrers & hrefs of each result URL once, results are sorted
+	for _, l := range []struct {
+		key  string
+		list func(string) ([]string, error)
+	}{{"referrers", rpt.referrers}, {"hrefs", rpt.hrefs}} {
+		doc.open(l.key, '{')
+
+		last := ""
+		if err := rpt.each(func(r validator.Result) error {
+			if r.URL == last {
+				return nil
+			}
+			last = r.URL
+
+			list, err := l.list(r.URL)
+			if err != nil || list == nil {
+				return err
+			}
+			doc.value(r.URL, list)
+			return doc.err
+		}); err != nil {
+			return err
+		}
+
+		doc.close()
+	}
+
+	doc.close()
+
+	return doc.flush()
+}
+
+// Indented JSON document written one value at a time, so large arrays &
+// objects can be streamed. Write errors are kept by the buffer, and the first
+// marshalling error is kept too, both returned by flush.
+type jsonWriter struct {
+	w          *bufio.Writer
+	escapeHTML bool
+	closing    []byte // closing brackets of the open arrays & objects
+	empty      []bool // whether the open arrays & objects have no values yet
+	err        error
+}
+
+// Return a new JSON writer
+func newJSONWriter(w io.Writer, escapeHTML bool) *jsonWriter {
+	return &jsonWriter{w: bufio.NewWriter(w), escapeHTML: escapeHTML}
+}
+
+// Open an array ('[') or object ('{'), the key is ignored within arrays
+func (j *jsonWriter) open(key string, opening byte) {
+	j.next(key)
+	_ = j.w.WriteByte(opening)
+
+	closing := byte(']')
+	if opening == '{' {
+		closing = '}'
+	}
+	j.closing = append(j.closing, closing)
+	j.empty = append(j.empty, true)
+}
+
+// Close the last array or object opened
+func (j *jsonWriter) close() {
+	n := len(j.closing) - 1
+
+	if !j.empty[n] {
+		_, _ = j.w.WriteString("\n" + strings.Repeat("  ", n))
+	}
+	_ = j.w.WriteByte(j.closing[n])
+
+	j.closing, j.empty = j.closing[:n], j.empty[:n]
+}
+
+// Write a value, the key is ignored within arrays
+func (j *jsonWriter) value(key string, v any) {
+	j.next(key)
+
+	b, err := marshalJSON(v, strings.Repeat("  ", len(j.closing)), j.escapeHTML)
+	if err != nil && j.err == nil {
+		j.err = err
+	}
+
+	_, _ = j.w.Write(b)
+}
+
+// Start the next value of the open array or object, writing its key if in an object
+func (j *jsonWriter) next(key string) {
+	n := len(j.closing) - 1
+	if n < 0 {
+		return
+	}
+
+	if !j.empty[n] {
+		_ = j.w.WriteByte(',')
+	}
+	j.empty[n] = false
+
+	_, _ = j.w.WriteString("\n" + strings.Repeat("  ", n+1))
+
+	if j.closing[n] == '}' {
+		// strings always marshal
+		k, _ := marshalJSON(key, "", j.escapeHTML)
+		_, _ = j.w.Write(k)
+		_, _ = j.w.WriteString(": ")
+	}
+}
+
+// Write the final newline & flush the document, returning the first error
+func (j *jsonWriter) flush() error {
+	_ = j.w.WriteByte('\n')
+
+	if j.err != nil {
+		return j.err
+	}
+
+	return j.w.Flush()
+}
+
+// Marshal v as indented JSON, continuing lines with the prefix
+func marshalJSON(v any, prefix string, escapeHTML bool) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent(prefix, "  ")
+	enc.SetEscapeHTML(escapeHTML)
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
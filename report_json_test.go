@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+func TestWriteJSONReport(t *testing.T) {
+	crawl := &validator.Report{
+		LinksProcessed:  2,
+		ErrorsProcessed: 1,
+		Truncated:       validator.TruncatedMaxPages,
+		Results: []validator.Result{
+			{URL: "https://example.com/", Type: "parse", StatusCode: 200},
+			{URL: "https://example.com/a?b", StatusCode: 404, Issues: []validator.Issue{
+				{Code: "broken-link", Severity: validator.SeverityError, Category: "broken-link", Message: "returned status 404 <html>"},
+			}},
+		},
+		Referrers: map[string][]string{"https://example.com/a?b": {"https://example.com/"}},
+		Hrefs:     map[string][]string{"https://example.com/a?b": {"https://example.com/a?b&utm_source=x"}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSONReport(&buf, newReport(crawl, true)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the streamed report is written like the whole document
+	rpt := newReport(crawl, true)
+	doc := struct {
+		report
+		Results   []validator.Result  `json:"results"`
+		Referrers map[string][]string `json:"referrers"`
+		Hrefs     map[string][]string `json:"hrefs"`
+	}{rpt, crawl.Results, crawl.Referrers, crawl.Hrefs}
+
+	var want bytes.Buffer
+	enc := json.NewEncoder(&want)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != want.String() {
+		t.Errorf("expected\n%s\ngot\n%s", want.String(), buf.String())
+	}
+
+	// empty arrays & objects
+	buf.Reset()
+	if err := writeJSONReport(&buf, newReport(&validator.Report{}, true)); err != nil {
+		t.Fatal(err)
+	}
+
+	empty := "{\n  \"linksProcessed\": 0,\n  \"errorsProcessed\": 0,\n  \"warningsProcessed\": 0,\n  \"noticesProcessed\": 0,\n  \"timeTaken\": 0,\n  \"results\": [],\n  \"referrers\": {},\n  \"hrefs\": {}\n}\n"
+	if buf.String() != empty {
+		t.Errorf("expected\n%s\ngot\n%s", empty, buf.String())
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+// JUnit property
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// JUnit testcase, one per URL
+type junitTestCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	Failures  []junitFailure `xml:"failure"`
+	SystemOut string         `xml:"system-out,omitempty"` // the warnings & notices
+}
+
+// JUnit failure, one per error
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Write the report as JUnit XML, each URL being a testcase. The results are
+// counted first, as the counts are attributes of the test suite.
+func writeJUnitReport(w io.Writer, rpt report) error {
+	tests, failures := 0, 0
+
+	err := rpt.each(func(r validator.Result) error {
+		tests++
+		if len(junitFailures(r)) > 0 {
+			failures++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	properties := []junitProperty{
+		{Name: "linksProcessed", Value: strconv.Itoa(rpt.LinksProcessed)},
+		{Name: "errorsProcessed", Value: strconv.Itoa(rpt.ErrorsProcessed)},
+	}
+
+	if rpt.Truncated != "" {
+		properties = append(properties, junitProperty{Name: "truncated", Value: rpt.Truncated})
+	}
+
+	timeTaken := strconv.FormatFloat(rpt.TimeTaken, 'g', -1, 64)
+
+	suites := xml.StartElement{Name: xml.Name{Local: "testsuites"}, Attr: []xml.Attr{
+		{Name: xml.Name{Local: "name"}, Value: "web-validator"},
+		{Name: xml.Name{Local: "tests"}, Value: strconv.Itoa(tests)},
+		{Name: xml.Name{Local: "failures"}, Value: strconv.Itoa(failures)},
+		{Name: xml.Name{Local: "time"}, Value: timeTaken},
+	}}
+
+	suite := xml.StartElement{Name: xml.Name{Local: "testsuite"}, Attr: []xml.Attr{
+		{Name: xml.Name{Local: "name"}, Value: "web-validator"},
+		{Name: xml.Name{Local: "tests"}, Value: strconv.Itoa(tests)},
+		{Name: xml.Name{Local: "failures"}, Value: strconv.Itoa(failures)},
+		{Name: xml.Name{Local: "errors"}, Value: "0"},
+		{Name: xml.Name{Local: "time"}, Value: timeTaken},
+	}}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	if err := enc.EncodeToken(suites); err != nil {
+		return err
+	}
+
+	if err := enc.EncodeToken(suite); err != nil {
+		return err
+	}
+
+	if err := enc.EncodeElement(struct {
+		Properties []junitProperty `xml:"property"`
+	}{properties}, xml.StartElement{Name: xml.Name{Local: "properties"}}); err != nil {
+		return err
+	}
+
+	err = rpt.each(func(r validator.Result) error {
+		tc := junitTestCase{
+			Name:      r.URL,
+			Failures:  junitFailures(r),
+			SystemOut: junitSystemOut(r),
+		}
+
+		// group testcases by host
+		if u, err := url.Parse(r.URL); err == nil {
+			tc.ClassName = u.Host
+		}
+
+		return enc.EncodeElement(tc, xml.StartElement{Name: xml.Name{Local: "testcase"}})
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := enc.EncodeToken(suite.End()); err != nil {
+		return err
+	}
+
+	if err := enc.EncodeToken(suites.End()); err != nil {
+		return err
+	}
+
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+
+	return err
+}
+
+// Return the JUnit failures of a result, one per error
+func junitFailures(r validator.Result) []junitFailure {
+	failures := []junitFailure{}
+
+	for _, i := range r.Issues {
+		if i.Severity != validator.SeverityError {
+			continue
+		}
+
+		f := junitFailure{
+			Message: i.Message,
+			Type:    i.Code,
+		}
+
+		if i.Validation != nil {
+			f.Message = fmt.Sprintf("line %d: %s", i.Validation.LastLine, i.Message)
+			f.Text = i.Validation.Extract
+		}
+
+		failures = append(failures, f)
+	}
+
+	return failures
+}
+
+// Return the warnings & notices of a result, one per line, as they do not
+// fail the testcase
+func junitSystemOut(r validator.Result) string {
+	lines := []string{}
+
+	for _, i := range r.Issues {
+		if i.Severity == validator.SeverityError {
+			continue
+		}
+
+		if i.Validation != nil {
+			lines = append(lines, fmt.Sprintf("[%s] %s: line %d: %s", i.Severity, i.Code, i.Validation.LastLine, i.Message))
+		} else {
+			lines = append(lines, fmt.Sprintf("[%s] %s: %s", i.Severity, i.Code, i.Message))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
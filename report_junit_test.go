@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+func TestWriteJUnitReport(t *testing.T) {
+	crawl := &validator.Report{
+		Results: []validator.Result{
+			{URL: "https://example.com/", Type: "parse", StatusCode: 200, Issues: []validator.Issue{
+				{Code: "html-validation", Severity: validator.SeverityError, Category: "validation", Message: "Stray end tag"},
+				{Code: "sitemap-missing", Severity: validator.SeverityWarning, Category: "sitemap", Message: "page is not listed in the sitemap"},
+			}},
+			{URL: "https://example.com/a", Type: "parse", StatusCode: 200, Issues: []validator.Issue{
+				{Code: "html-validation", Severity: validator.SeverityNotice, Category: "validation", Message: "Consider adding a lang attribute"},
+			}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeJUnitReport(&buf, newReport(crawl, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	junit := struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Suite    struct {
+			Failures  int             `xml:"failures,attr"`
+			TestCases []junitTestCase `xml:"testcase"`
+		} `xml:"testsuite"`
+	}{}
+	if err := xml.Unmarshal(buf.Bytes(), &junit); err != nil {
+		t.Fatalf("invalid XML: %s\n%s", err, buf.String())
+	}
+
+	// only errors fail a testcase, warnings & notices are its output
+	if junit.Tests != 2 || junit.Failures != 1 || junit.Suite.Failures != 1 || len(junit.Suite.TestCases) != 2 {
+		t.Fatalf("expected 2 tests, 1 failing, got\n%s", buf.String())
+	}
+
+	tc := junit.Suite.TestCases[0]
+	if len(tc.Failures) != 1 || tc.Failures[0].Type != "html-validation" || tc.SystemOut != "[warning] sitemap-missing: page is not listed in the sitemap" {
+		t.Errorf("expected the error as a failure & the warning as output, got\n%s", buf.String())
+	}
+
+	tc = junit.Suite.TestCases[1]
+	if len(tc.Failures) != 0 || !strings.HasPrefix(tc.SystemOut, "[notice] html-validation:") {
+		t.Errorf("expected the notice as output, got\n%s", buf.String())
+	}
+}
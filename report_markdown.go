@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+// Write the report as Markdown, suitable for pull request comments
+func writeMarkdownReport(w io.Writer, rpt report) error {
+	// write errors are kept by the buffer & returned by Flush
+	b := bufio.NewWriter(w)
+
+	_, _ = b.WriteString("## Web-validator report\n\n")
+	_, _ = b.WriteString("| Scanned | Errors | Time |\n")
+	_, _ = b.WriteString("| ---: | ---: | ---: |\n")
+	fmt.Fprintf(b, "| %d | %d | %vs |\n\n", rpt.LinksProcessed, rpt.ErrorsProcessed, rpt.TimeTaken)
+
+	if rpt.Truncated != "" {
+		fmt.Fprintf(b, "_The scan stopped early (`--%s` reached)_\n\n", rpt.Truncated)
+	}
+
+	failing := 0
+
+	err := rpt.each(func(r validator.Result) error {
+		failing++
+		if maxReportItems > 0 && failing > maxReportItems {
+			return nil
+		}
+
+		fmt.Fprintf(b, "<details>\n<summary>%s (%d)</summary>\n\n", mdEscape(r.URL), len(r.Issues))
+
+		if r.Redirect != "" {
+			fmt.Fprintf(b, "- **Redirect:** %s\n", mdEscape(r.Redirect))
+		}
+
+		if r.StatusCode > 0 {
+			fmt.Fprintf(b, "- **Status:** %d (%s)\n", r.StatusCode, http.StatusText(r.StatusCode))
+		}
+
+		refs, err := rpt.referrers(r.URL)
+		if err != nil {
+			return err
+		}
+
+		if len(refs) > 0 {
+			_, _ = b.WriteString("- **Refs:**\n")
+			for j, ref := range refs {
+				if j == 3 {
+					fmt.Fprintf(b, "  - ... (%dx)\n", len(refs))
+					break
+				}
+				fmt.Fprintf(b, "  - %s\n", mdEscape(ref))
+			}
+		}
+
+		_, _ = b.WriteString("- **Errors:**\n")
+		for _, i := range r.Issues {
+			if i.Validation != nil {
+				fmt.Fprintf(b, "  - `%s` [#%d] %s\n", i.Code, i.Validation.LastLine, mdEscape(i.Message))
+			} else {
+				fmt.Fprintf(b, "  - `%s` %s\n", i.Code, mdEscape(i.Message))
+			}
+		}
+
+		_, _ = b.WriteString("\n</details>\n")
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if failing == 0 {
+		_, _ = b.WriteString("No problems found :tada:\n")
+	}
+
+	if maxReportItems > 0 && failing > maxReportItems {
+		fmt.Fprintf(b, "\n_... and %d more_\n", failing-maxReportItems)
+	}
+
+	return b.Flush()
+}
+
+// Escape text for use in Markdown & inline HTML
+func mdEscape(s string) string {
+	return strings.ReplaceAll(html.EscapeString(strings.TrimSpace(s)), "`", "&#96;")
+}
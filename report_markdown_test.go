@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+func TestWriteMarkdownReport(t *testing.T) {
+	crawl := &validator.Report{LinksProcessed: 3, ErrorsProcessed: 3}
+	for n := 1; n <= 3; n++ {
+		crawl.Results = append(crawl.Results, validator.Result{URL: fmt.Sprintf("https://example.com/%d", n), StatusCode: 404, Issues: []validator.Issue{
+			{Code: "broken-link", Severity: validator.SeverityError, Category: "broken-link", Message: "returned status 404"},
+		}})
+	}
+
+	maxReportItems = 2
+	t.Cleanup(func() { maxReportItems = 0 })
+
+	var buf bytes.Buffer
+	if err := writeMarkdownReport(&buf, newReport(crawl, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the first failing URLs are listed, the others counted
+	md := buf.String()
+	if n := strings.Count(md, "<details>"); n != 2 {
+		t.Errorf("expected 2 failing URLs, got %d in\n%s", n, md)
+	}
+	if strings.Contains(md, "https://example.com/3") || !strings.HasSuffix(md, "\n_... and 1 more_\n") {
+		t.Errorf("expected the third URL to be counted only, got\n%s", md)
+	}
+}
+
+func TestWriteMarkdownReportEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeMarkdownReport(&buf, newReport(&validator.Report{}, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "No problems found") {
+		t.Errorf("expected no problems, got\n%s", buf.String())
+	}
+}
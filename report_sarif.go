@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+// SARIF invocation, unsuccessful if the scan stopped early
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+// SARIF notification
+type sarifNotification struct {
+	Level   string       `json:"level"`
+	Message sarifMessage `json:"message"`
+}
+
+// SARIF tool
+type sarifTool struct {
+	Driver struct {
+		Name           string      `json:"name"`
+		Version        string      `json:"version"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	} `json:"driver"`
+}
+
+// SARIF rule
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+// SARIF message
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+// SARIF result
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	RuleIndex        int             `json:"ruleIndex"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+// SARIF location
+type sarifLocation struct {
+	ID               int `json:"id,omitempty"`
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+	Message *sarifMessage `json:"message,omitempty"`
+}
+
+// SARIF region
+type sarifRegion struct {
+	StartLine   int           `json:"startLine"`
+	StartColumn int           `json:"startColumn,omitempty"`
+	EndLine     int           `json:"endLine,omitempty"`
+	EndColumn   int           `json:"endColumn,omitempty"`
+	Snippet     *sarifMessage `json:"snippet,omitempty"`
+}
+
+// Write the report as a SARIF 2.1.0 log, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/. The log has a single run,
+// its results are streamed.
+func writeSARIFReport(w io.Writer, rpt report) error {
+	tool := sarifTool{}
+	tool.Driver.Name = "web-validator"
+	tool.Driver.Version = appVersion
+	tool.Driver.InformationURI = "https://github.com/axllent/web-validator"
+
+	invocation := sarifInvocation{ExecutionSuccessful: !rpt.Interrupted && rpt.Truncated == ""}
+	if rpt.Truncated != "" {
+		invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, sarifNotification{
+			Level:   "warning",
+			Message: sarifMessage{Text: fmt.Sprintf("The scan stopped early (--%s reached)", rpt.Truncated)},
+		})
+	}
+	if rpt.Interrupted {
+		invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, sarifNotification{
+			Level:   "warning",
+			Message: sarifMessage{Text: "The scan was interrupted"},
+		})
+	}
+
+	ruleIndex := make(map[string]int)
+	for i, t := range validator.IssueTypes {
+		ruleIndex[t.Code] = i
+		tool.Driver.Rules = append(tool.Driver.Rules, sarifRule{
+			ID:               t.Code,
+			ShortDescription: sarifMessage{Text: t.Description},
+		})
+	}
+
+	doc := newJSONWriter(w, true)
+
+	doc.open("", '{')
+	doc.value("$schema", "https://json.schemastore.org/sarif-2.1.0.json")
+	doc.value("version", "2.1.0")
+	doc.open("runs", '[')
+	doc.open("", '{')
+	doc.value("tool", tool)
+	doc.value("invocations", []sarifInvocation{invocation})
+	doc.open("results", '[')
+
+	// write a SARIF result for each issue of a result
+	err := rpt.each(func(r validator.Result) error {
+		for _, i := range r.Issues {
+			res := sarifResult{
+				RuleID:    i.Code,
+				RuleIndex: ruleIndex[i.Code],
+				Level:     i.Severity,
+				Message:   sarifMessage{Text: i.Message},
+			}
+
+			if i.Severity == validator.SeverityNotice {
+				res.Level = "note"
+			}
+
+			loc := sarifLocation{}
+			loc.PhysicalLocation.ArtifactLocation.URI = r.URL
+
+			if v := i.Validation; v != nil && v.LastLine > 0 {
+				region := &sarifRegion{
+					StartLine:   v.FirstLine,
+					StartColumn: v.FirstColumn,
+					EndLine:     v.LastLine,
+				}
+				if v.LastColumn > 0 {
+					// SARIF end columns are exclusive
+					region.EndColumn = v.LastColumn + 1
+				}
+				if v.Extract != "" {
+					region.Snippet = &sarifMessage{Text: v.Extract}
+				}
+				loc.PhysicalLocation.Region = region
+			}
+
+			res.Locations = []sarifLocation{loc}
+
+			if i.OnReferrers() {
+				refs, err := rpt.referrers(r.URL)
+				if err != nil {
+					return err
+				}
+
+				for n, ref := range refs {
+					rel := sarifLocation{ID: n + 1, Message: &sarifMessage{Text: "referenced here"}}
+					rel.PhysicalLocation.ArtifactLocation.URI = ref
+					res.RelatedLocations = append(res.RelatedLocations, rel)
+				}
+			}
+
+			doc.value("", res)
+		}
+
+		return doc.err
+	})
+	if err != nil {
+		return err
+	}
+
+	doc.close()
+	doc.close()
+	doc.close()
+	doc.close()
+
+	return doc.flush()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+func TestWriteSARIFReport(t *testing.T) {
+	crawl := &validator.Report{
+		Truncated: validator.TruncatedMaxTime,
+		Results: []validator.Result{
+			{URL: "https://example.com/", Type: "parse", StatusCode: 200, Issues: []validator.Issue{
+				{Code: "html-validation", Severity: validator.SeverityError, Category: "validation", Message: "Stray end tag"},
+			}},
+			{URL: "https://example.com/a", StatusCode: 404, Issues: []validator.Issue{
+				{Code: "broken-link", Severity: validator.SeverityError, Category: "broken-link", Message: "returned status 404"},
+			}},
+			{URL: "https://example.com/b", Type: "parse", StatusCode: 200, Issues: []validator.Issue{
+				{Code: "sitemap-missing", Severity: validator.SeverityWarning, Category: "sitemap", Target: "https://example.com/b", Message: "page is not listed in the sitemap"},
+			}},
+		},
+		Referrers: map[string][]string{"https://example.com/a": {"https://example.com/"}, "https://example.com/b": {"https://example.com/"}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeSARIFReport(&buf, newReport(crawl, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	sarif := struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool        sarifTool         `json:"tool"`
+			Invocations []sarifInvocation `json:"invocations"`
+			Results     []sarifResult     `json:"results"`
+		} `json:"runs"`
+	}{}
+	if err := json.Unmarshal(buf.Bytes(), &sarif); err != nil {
+		t.Fatalf("invalid JSON: %s\n%s", err, buf.String())
+	}
+
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 {
+		t.Fatalf("expected a single SARIF 2.1.0 run, got\n%s", buf.String())
+	}
+
+	run := sarif.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(validator.IssueTypes) || len(run.Invocations) != 1 || run.Invocations[0].ExecutionSuccessful {
+		t.Errorf("expected the rules & an unsuccessful invocation, got\n%s", buf.String())
+	}
+
+	// only link issues are located on the referring pages
+	if len(run.Results) != 3 || run.Results[0].RuleID != "html-validation" || len(run.Results[1].RelatedLocations) != 1 || len(run.Results[2].RelatedLocations) != 0 {
+		t.Errorf("expected 3 results, the broken link referenced once, got\n%s", buf.String())
+	}
+}
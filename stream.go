@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+var (
+	streamOutput io.Writer
+	streamFile   *os.File
+	streamMutex  = sync.Mutex{}
+
+	// known issues still allowed in streamed results
+	streamBaseline      map[string]int
+	streamBaselineMutex = sync.Mutex{}
+)
+
+// Stream start event
+type streamStart struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	URLs  []string  `json:"urls"` // the start URLs
+}
+
+// Stream result event, one per finished request
+type streamResultEvent struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Duration int64     `json:"duration"` // milliseconds
+	validator.Result
+}
+
+// Stream finish event, with the summary of the JSON report
+type streamFinish struct {
+	Event             string    `json:"event"`
+	Time              time.Time `json:"time"`
+	LinksProcessed    int       `json:"linksProcessed"`
+	ErrorsProcessed   int       `json:"errorsProcessed"`
+	WarningsProcessed int       `json:"warningsProcessed"`
+	NoticesProcessed  int       `json:"noticesProcessed"`
+	TimeTaken         float64   `json:"timeTaken"`
+	Interrupted       bool      `json:"interrupted,omitempty"`
+	Truncated         string    `json:"truncated,omitempty"`
+	Suppressed        int       `json:"suppressed,omitempty"`
+}
+
+// Open the NDJSON stream (stdout or the output file) and write the start event
+func startStream(startURLs []string) error {
+	streamOutput = os.Stdout
+
+	if reportOutput != "" {
+		f, err := os.Create(reportOutput)
+		if err != nil {
+			return err
+		}
+
+		streamFile = f
+		streamOutput = f
+	}
+
+	return streamEvent(streamStart{Event: "start", Time: time.Now(), URLs: startURLs})
+}
+
+// Write a result event, without the issues known in the baseline
+func streamResult(r validator.Result, duration time.Duration) {
+	if len(baselineKeys) > 0 {
+		streamBaselineMutex.Lock()
+		if streamBaseline == nil {
+			streamBaseline = baselineRemaining()
+		}
+		filterBaseline(&r, streamBaseline)
+		streamBaselineMutex.Unlock()
+	}
+
+	_ = streamEvent(streamResultEvent{
+		Event:    "result",
+		Time:     time.Now(),
+		Duration: duration.Milliseconds(),
+		Result:   r,
+	})
+}
+
+// Write the finish event and close the stream
+func finishStream(crawl *validator.Report) error {
+	err := streamEvent(streamFinish{
+		Event:             "finish",
+		Time:              time.Now(),
+		LinksProcessed:    crawl.LinksProcessed,
+		ErrorsProcessed:   crawl.ErrorsProcessed,
+		WarningsProcessed: crawl.WarningsProcessed,
+		NoticesProcessed:  crawl.NoticesProcessed,
+		TimeTaken:         crawl.TimeTaken,
+		Interrupted:       crawl.Interrupted,
+		Truncated:         crawl.Truncated,
+		Suppressed:        suppressedProblems,
+	})
+
+	if streamFile != nil {
+		if cerr := streamFile.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Write a single event as a line of JSON
+func streamEvent(event interface{}) error {
+	streamMutex.Lock()
+	defer streamMutex.Unlock()
+
+	if streamOutput == nil {
+		return nil
+	}
+
+	enc := json.NewEncoder(streamOutput)
+	enc.SetEscapeHTML(false)
+
+	return enc.Encode(event)
+}
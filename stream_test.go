@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+func TestFinishStream(t *testing.T) {
+	var buf bytes.Buffer
+	streamOutput = &buf
+	t.Cleanup(func() { streamOutput = nil })
+
+	crawl := &validator.Report{LinksProcessed: 3, ErrorsProcessed: 1, WarningsProcessed: 2, NoticesProcessed: 4, Interrupted: true}
+	if err := finishStream(crawl); err != nil {
+		t.Fatal(err)
+	}
+
+	got := streamFinish{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %s\n%s", err, buf.String())
+	}
+
+	// the finish event has the summary of the JSON report
+	if got.Event != "finish" || got.LinksProcessed != 3 || got.ErrorsProcessed != 1 || got.WarningsProcessed != 2 || got.NoticesProcessed != 4 || !got.Interrupted {
+		t.Errorf("expected the summary of the interrupted crawl, got %s", buf.String())
+	}
+}
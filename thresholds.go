@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/axllent/web-validator/validator"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	categoryThresholds = make(map[string]int)
+)
+
+// Parse comma-separated category thresholds, eg: broken-link=0,validation=20
+func parseThresholds(s string) error {
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+
+		parts := strings.SplitN(t, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid threshold: %s", t)
+		}
+
+		category := strings.TrimSpace(parts[0])
+		if !slices.Contains(validator.IssueCategories, category) {
+			return fmt.Errorf("invalid threshold category: %s", category)
+		}
+
+		max, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || max < 0 {
+			return fmt.Errorf("invalid threshold: %s", t)
+		}
+
+		categoryThresholds[category] = max
+	}
+
+	return nil
+}
+
+// Return the reasons the scan failed, if any. Issues are counted by severity
+// according to failOn, and per category for the category thresholds.
+func failedThresholds(crawl *validator.Report) ([]string, error) {
+	reasons := []string{}
+	failing := 0
+	categories := make(map[string]int)
+
+	err := newReport(crawl, false).each(func(r validator.Result) error {
+		for _, i := range r.Issues {
+			categories[i.Category]++
+
+			if i.Severity == validator.SeverityError || failOn == "warning" && i.Severity == validator.SeverityWarning {
+				failing++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if failOn != "none" && failing > maxErrors {
+		reasons = append(reasons, fmt.Sprintf("%d problems (%s or higher), maximum %d", failing, failOn, maxErrors))
+	}
+
+	names := []string{}
+	for c := range categoryThresholds {
+		names = append(names, c)
+	}
+	sort.Strings(names)
+
+	for _, c := range names {
+		if categories[c] > categoryThresholds[c] {
+			reasons = append(reasons, fmt.Sprintf("%d %s problems, maximum %d", categories[c], c, categoryThresholds[c]))
+		}
+	}
+
+	return reasons, nil
+}
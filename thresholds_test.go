@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+func TestParseThresholds(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // the thresholds, or the error
+	}{
+		{"", "map[]"},
+		{"broken-link=0", "map[broken-link:0]"},
+		{" broken-link = 0 , validation=20,", "map[broken-link:0 validation:20]"},
+		{"broken-link=1,broken-link=2", "map[broken-link:2]"},
+		{"broken-link", "invalid threshold: broken-link"},
+		{"broken=0", "invalid threshold category: broken"},
+		{"validation=-1", "invalid threshold: validation=-1"},
+		{"validation=many", "invalid threshold: validation=many"},
+	}
+
+	for _, tt := range tests {
+		categoryThresholds = make(map[string]int)
+
+		err := parseThresholds(tt.in)
+		got := fmt.Sprint(categoryThresholds)
+		if err != nil {
+			got = err.Error()
+		}
+
+		if got != tt.want {
+			t.Errorf("%q: expected %s, got %s", tt.in, tt.want, got)
+		}
+	}
+
+	categoryThresholds = make(map[string]int)
+}
+
+func TestFailedThresholds(t *testing.T) {
+	crawl := &validator.Report{Results: []validator.Result{
+		{URL: "https://example.com/a", Issues: []validator.Issue{
+			{Code: "broken-link", Category: "broken-link", Severity: validator.SeverityError},
+			{Code: "sitemap-missing", Category: "sitemap", Severity: validator.SeverityWarning},
+		}},
+		{URL: "https://example.com/b", Issues: []validator.Issue{
+			{Code: "broken-link", Category: "broken-link", Severity: validator.SeverityError},
+		}},
+	}}
+
+	tests := []struct {
+		failOn     string
+		maxErrors  int
+		thresholds string
+		want       string // the reasons, joined with "; "
+	}{
+		{"error", 0, "", "2 problems (error or higher), maximum 0"},
+		{"error", 2, "", ""},
+		{"warning", 2, "", "3 problems (warning or higher), maximum 2"},
+		{"warning", 3, "", ""},
+		{"none", 0, "", ""},
+		{"none", 0, "sitemap=0", "1 sitemap problems, maximum 0"},
+		{"error", 2, "validation=0,broken-link=1,sitemap=1", "2 broken-link problems, maximum 1"},
+	}
+
+	defer func() {
+		failOn, maxErrors = "error", 0
+		categoryThresholds = make(map[string]int)
+	}()
+
+	for _, tt := range tests {
+		failOn, maxErrors = tt.failOn, tt.maxErrors
+		categoryThresholds = make(map[string]int)
+		if err := parseThresholds(tt.thresholds); err != nil {
+			t.Fatal(err)
+		}
+
+		reasons, err := failedThresholds(crawl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Join(reasons, "; "); got != tt.want {
+			t.Errorf("--fail-on %s --max-errors %d --threshold %q: expected %q, got %q", tt.failOn, tt.maxErrors, tt.thresholds, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,684 @@
+// Package validator crawls a website, checking links & resources and
+// validating HTML & CSS with the Nu Html validator.
+package validator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultValidator is the public Nu Html validator
+const DefaultValidator = "https://validator.w3.org/nu/"
+
+// Budgets which stop a crawl early, see Report.Truncated
+const (
+	TruncatedMaxPages      = "max-pages"
+	TruncatedMaxTime       = "max-time"
+	TruncatedFailFastAfter = "fail-fast-after"
+)
+
+// Options for a crawl
+type Options struct {
+	// URL to start crawling from
+	URL string
+	// URLs to start crawling from too, sharing the report. The hosts of all
+	// start URLs are internal.
+	URLs []string
+	// MaxDepth of internal links to follow, -1 for all. The depth of a URL is
+	// the shortest number of links from the start URL, assets being linked from
+	// their page, and redirects have the depth of the redirecting URL.
+	// Stylesheets of pages at MaxDepth are still parsed & validated.
+	MaxDepth int
+	// CheckOutbound links (HEAD only)
+	CheckOutbound bool
+	// ValidateHTML with the Nu validator
+	ValidateHTML bool
+	// ValidateCSS with the Nu validator
+	ValidateCSS bool
+	// ShowWarnings includes validation warnings & notices
+	ShowWarnings bool
+	// RedirectWarnings reports redirects rather than following them
+	RedirectWarnings bool
+	// NoRobots ignores robots.txt
+	NoRobots bool
+	// Sitemap URL to seed the crawl from (sitemap or sitemap index, gzipped
+	// or not), or SitemapAuto. Pages missing from the sitemap, and URLs in the
+	// sitemap not returning a 200 are reported.
+	Sitemap string
+	// Validator is the Nu Html validator address (default DefaultValidator)
+	Validator string
+	// Ignore URLs matching these patterns, wildcards allowed (*.jpg, example.com).
+	// Ignored URLs are skipped entirely.
+	Ignore []string
+	// Include only follows internal pages matching these patterns, wildcards
+	// allowed. Other internal pages are only checked.
+	Include []string
+	// NoFollow only checks internal pages matching these patterns, wildcards
+	// allowed, without following their links
+	NoFollow []string
+	// PathPrefix only follows internal pages under this path (eg: /docs/).
+	// Other internal pages are only checked.
+	PathPrefix string
+	// Subdomains of the start URL hosts are internal
+	Subdomains bool
+	// Hosts which are internal too, eg: aliases like www.example.com
+	Hosts []string
+	// StripParams removes query parameters matching these names from links,
+	// wildcards allowed (utm_*, fbclid). Links are always normalized (case,
+	// default ports, percent-encoding & fragments).
+	StripParams []string
+	// SortParams sorts the query parameters of links
+	SortParams bool
+	// TrailingSlash treats links with & without a trailing slash as the same
+	// page, which is requested as first seen
+	TrailingSlash bool
+
+	// Crawler traps: pages beyond these limits are skipped, and reported once
+	// per trap with the number of links skipped. 0 for no limit.
+
+	// MaxURLLength of pages
+	MaxURLLength int
+	// MaxRepeats of a path segment in pages, eg: /a/b/a/b/a/b
+	MaxRepeats int
+	// MaxVariants of pages with different queries of the same path
+	MaxVariants int
+	// PageCaps is the maximum number of pages matching each pattern,
+	// wildcards allowed (eg: "*/calendar/*": 50)
+	PageCaps map[string]int
+	// Threads is the number of concurrent requests (default 5)
+	Threads int
+	// Timeout of each request (default 10s)
+	Timeout time.Duration
+	// UserAgent of requests (default "web-validator")
+	UserAgent string
+	// StateDir to write checkpoints of the crawl to, for resuming it later
+	StateDir string
+	// Resume the crawl from the checkpoint in StateDir, if it exists
+	Resume bool
+	// CheckpointInterval between checkpoints (default 30s). A checkpoint is
+	// also written when the crawl finishes or is cancelled.
+	CheckpointInterval time.Duration
+	// DiskStore keeps the queued links, the links seen & the results on disk
+	// rather than in memory, for very large sites. The results are read from
+	// disk by the Report, which must be closed. The store is kept in StateDir
+	// if set, else in a temporary directory removed when the Report is closed.
+	DiskStore bool
+	// MaxBodySize of pages & stylesheets to parse & validate (default 10MB)
+	MaxBodySize int64
+
+	// MaxPages to crawl, 0 for all. Links to further pages are only checked.
+	MaxPages int
+	// MaxTime of the crawl, 0 for none. No more links are crawled once it has
+	// passed, and the in-flight requests are finished.
+	MaxTime time.Duration
+	// FailFastAfter stops the crawl like MaxTime after this many errors, 0 for none
+	FailFastAfter int
+	// FailFastIssues returns the issues of a result counted towards
+	// FailFastAfter, such as those not already known. All the issues are
+	// counted if nil. It may be called concurrently from several workers.
+	FailFastIssues func(r Result) []Issue
+
+	// Transport of all requests. If set, the connection options below are ignored.
+	Transport http.RoundTripper
+	// MaxIdleConnsPerHost kept for reuse (default Threads)
+	MaxIdleConnsPerHost int
+	// DisableHTTP2 uses HTTP/1.1 only
+	DisableHTTP2 bool
+	// DisableCompression does not request gzip responses
+	DisableCompression bool
+	// DialTimeout of new connections (default 30s)
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout of new connections (default 10s)
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout waiting for the response headers (default none)
+	ResponseHeaderTimeout time.Duration
+
+	// OnProgress is called when a new link is queued. It may be called
+	// concurrently from several workers.
+	OnProgress func(link string, linksProcessed, errorsProcessed int)
+	// OnResult is called when a request has finished. It may be called
+	// concurrently from several workers.
+	OnResult func(r Result, duration time.Duration)
+}
+
+// Crawler crawls & validates a website. A Crawler can only be run once.
+type Crawler struct {
+	opts          Options
+	ignoreMatches []*regexp.Regexp
+	includes      []*regexp.Regexp
+	noFollows     []*regexp.Regexp
+	pageCaps      []pageCap
+	traps         *trapState
+	internalHosts map[string]bool
+	robots        map[string]string // robots.txt of the internal hosts which have one
+	sitemapURLs   map[string]string // URL => sitemap listing it, read-only once loaded
+	store         store
+	frontier      *frontier
+	transport     http.RoundTripper
+	client        *http.Client
+	connStats     ConnStats
+
+	resultsMutex      sync.Mutex
+	validatorMutex    sync.Mutex
+	linksProcessed    int
+	pagesProcessed    int
+	errorsProcessed   int
+	failFastProcessed int     // errors counted towards FailFastAfter
+	truncated         string  // budget which stopped the crawl early
+	halted            bool    // no more links are handed out
+	elapsed           float64 // seconds, of previous runs when resumed
+	sitemapsRead      int     // sitemaps added as results, including by previous runs
+}
+
+// Report of a crawl. With Options.DiskStore the results, referrers & hrefs
+// are not loaded into memory: read them with EachResult, ReferrersOf & HrefsOf,
+// and Close the report when done.
+type Report struct {
+	LinksProcessed    int                 `json:"linksProcessed"`
+	ErrorsProcessed   int                 `json:"errorsProcessed"`
+	WarningsProcessed int                 `json:"warningsProcessed"`
+	NoticesProcessed  int                 `json:"noticesProcessed"`
+	TimeTaken         float64             `json:"timeTaken"`
+	Interrupted       bool                `json:"interrupted,omitempty"`
+	Truncated         string              `json:"truncated,omitempty"` // budget which stopped the crawl early, if any
+	Connections       ConnStats           `json:"connections"`
+	Results           []Result            `json:"results"`
+	Referrers         map[string][]string `json:"referrers"`
+	Hrefs             map[string][]string `json:"hrefs,omitempty"` // original links of normalized URLs
+
+	store store // the disk store, if the results are not loaded
+}
+
+// Result of a single URL
+type Result struct {
+	URL        string  `json:"url"`
+	Type       string  `json:"type,omitempty"`
+	Depth      int     `json:"depth"`
+	StatusCode int     `json:"statusCode"`
+	Redirect   string  `json:"redirect,omitempty"`
+	Issues     []Issue `json:"issues,omitempty"`
+}
+
+// New returns a Crawler for the options
+func New(opts Options) (*Crawler, error) {
+	internalHosts := make(map[string]bool)
+
+	for _, s := range append([]string{opts.URL}, opts.URLs...) {
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("please use a full URL: %s", s)
+		}
+		internalHosts[getHost(normalizeURL(s, nil, false))] = true
+	}
+
+	for _, h := range opts.Hosts {
+		if h = strings.TrimSpace(h); h != "" {
+			internalHosts[strings.ToLower(h)] = true
+		}
+	}
+
+	if opts.Validator == "" {
+		opts.Validator = DefaultValidator
+	}
+
+	v, err := url.Parse(opts.Validator)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Nu validator address: %s", opts.Validator)
+	}
+
+	q := v.Query()
+	// add `?out=json`
+	q.Set("out", "json")
+	v.RawQuery = q.Encode()
+	opts.Validator = v.String()
+
+	if opts.Threads < 1 {
+		opts.Threads = 5
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	if opts.UserAgent == "" {
+		opts.UserAgent = "web-validator"
+	}
+
+	if opts.CheckpointInterval <= 0 {
+		opts.CheckpointInterval = 30 * time.Second
+	}
+
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 10 << 20
+	}
+
+	c := &Crawler{
+		opts:          opts,
+		internalHosts: internalHosts,
+		robots:        make(map[string]string),
+		ignoreMatches: append([]*regexp.Regexp{}, defaultIgnoreMatches...),
+		traps:         newTrapState(),
+		transport:     newTransport(opts),
+	}
+
+	c.client = &http.Client{
+		Transport:     c.transport,
+		Timeout:       opts.Timeout,
+		CheckRedirect: c.redirectMiddleware,
+	}
+
+	ignores, err := wildcardPatterns(opts.Ignore)
+	if err != nil {
+		return nil, err
+	}
+	c.ignoreMatches = append(c.ignoreMatches, ignores...)
+
+	if c.includes, err = wildcardPatterns(opts.Include); err != nil {
+		return nil, err
+	}
+
+	if c.noFollows, err = wildcardPatterns(opts.NoFollow); err != nil {
+		return nil, err
+	}
+
+	if c.pageCaps, err = newPageCaps(opts.PageCaps); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Convert wildcard patterns to regex
+func wildcardPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	matches := []*regexp.Regexp{}
+
+	for _, i := range patterns {
+		i = strings.TrimSpace(i)
+		if i == "" {
+			continue
+		}
+		filter := strings.ReplaceAll(i, "*", "WILDCARD_CHARACTER_HERE")
+		filter = regexp.QuoteMeta(filter)
+		filter = strings.ReplaceAll(filter, "WILDCARD_CHARACTER_HERE", "(.*)")
+		re, err := regexp.Compile(filter)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, re)
+	}
+
+	return matches, nil
+}
+
+// Run the crawl, returning the report once all links have been processed.
+// If the context is cancelled, the partial report is returned with the
+// context error.
+func (c *Crawler) Run(ctx context.Context) (*Report, error) {
+	start := time.Now()
+
+	if c.opts.DiskStore {
+		s, err := newBoltStore(c.opts.StateDir, c.opts.Resume)
+		if err != nil {
+			return nil, err
+		}
+		c.store = s
+	} else {
+		c.store = newMemoryStore(c.opts.StateDir)
+	}
+
+	// the disk store is kept open for the report, see Report.Close
+	keepStore := false
+	defer func() {
+		if !keepStore {
+			_ = c.store.close()
+		}
+	}()
+
+	c.frontier = newFrontier(c.store, c.admit)
+
+	resumed := false
+	if c.opts.StateDir != "" && c.opts.Resume {
+		ok, err := c.loadCheckpoint()
+		if err != nil {
+			return nil, err
+		}
+		resumed = ok
+	}
+
+	// stop handing out links when cancelled, in-flight requests are aborted by the context
+	stop := context.AfterFunc(ctx, c.frontier.close)
+	defer stop()
+
+	// the budget includes fetching robots.txt & the sitemaps, and the time of
+	// previous runs when resumed
+	var maxTime *time.Timer
+	if c.opts.MaxTime > 0 {
+		maxTime = time.AfterFunc(c.opts.MaxTime-time.Duration(c.elapsed*float64(time.Second))-time.Since(start), func() {
+			c.halt(TruncatedMaxTime)
+		})
+		defer maxTime.Stop()
+	}
+
+	c.initRobotsTxt(ctx)
+
+	if !resumed {
+		for _, s := range c.startURLs() {
+			c.addQueueLink(ctx, s, "parse", "", 0)
+		}
+	}
+
+	if c.opts.Sitemap != "" {
+		c.loadSitemaps(ctx)
+	}
+
+	var checkpointErr error
+	finished := make(chan struct{})
+	checkpointsDone := make(chan struct{})
+
+	go func() {
+		defer close(checkpointsDone)
+
+		if c.opts.StateDir == "" {
+			return
+		}
+
+		ticker := time.NewTicker(c.opts.CheckpointInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-finished:
+				return
+			case <-ticker.C:
+				checkpointErr = c.writeCheckpoint(time.Since(start))
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.Threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.worker(ctx)
+		}()
+	}
+
+	wg.Wait()
+
+	if maxTime != nil {
+		maxTime.Stop()
+	}
+
+	close(finished)
+	<-checkpointsDone
+
+	if ctx.Err() == nil {
+		c.addTrapResults(ctx)
+	}
+
+	if c.opts.StateDir != "" {
+		checkpointErr = c.writeCheckpoint(time.Since(start))
+	}
+
+	rpt := &Report{
+		TimeTaken:   (time.Duration(c.elapsed*float64(time.Second)) + time.Since(start)).Round(time.Second).Seconds(),
+		Interrupted: ctx.Err() != nil,
+	}
+
+	if c.opts.DiskStore {
+		// the results are read from the store when reporting
+		rpt.store = c.store
+	} else if err := c.loadReport(rpt); err != nil {
+		return nil, err
+	}
+
+	// results are sorted by the store, so the report of the same site is the same every run
+	results := 0
+	if err := c.store.eachResult(func(r Result) error {
+		results++
+		for _, i := range r.Issues {
+			switch i.Severity {
+			case SeverityError:
+				rpt.ErrorsProcessed++
+			case SeverityWarning:
+				rpt.WarningsProcessed++
+			default:
+				rpt.NoticesProcessed++
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	rpt.LinksProcessed = c.linksProcessed
+	if c.stopped() {
+		// links admitted but not handed out before the crawl stopped are not processed
+		rpt.LinksProcessed = results
+	}
+	rpt.Truncated = c.truncatedBy()
+	rpt.Connections = ConnStats{
+		New:    atomic.LoadInt64(&c.connStats.New),
+		Reused: atomic.LoadInt64(&c.connStats.Reused),
+	}
+
+	keepStore = c.opts.DiskStore
+
+	if ctx.Err() != nil {
+		return rpt, ctx.Err()
+	}
+
+	if err := c.frontier.error(); err != nil {
+		return rpt, fmt.Errorf("error storing the crawl: %s", err)
+	}
+
+	if checkpointErr != nil {
+		return rpt, fmt.Errorf("error writing checkpoint: %s", checkpointErr)
+	}
+
+	return rpt, nil
+}
+
+// Load the results, referrers & hrefs of the in-memory store into the report
+func (c *Crawler) loadReport(rpt *Report) error {
+	rpt.Results = []Result{}
+
+	if err := c.store.eachResult(func(r Result) error {
+		rpt.Results = append(rpt.Results, r)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	refs, err := c.store.referrers()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range refs {
+		sort.Strings(r)
+	}
+	rpt.Referrers = refs
+
+	hrefs, err := c.store.hrefs()
+	if err != nil {
+		return err
+	}
+
+	for _, h := range hrefs {
+		sort.Strings(h)
+	}
+	rpt.Hrefs = hrefs
+
+	return nil
+}
+
+// EachResult calls fn for each result, sorted by URL & type
+func (rpt *Report) EachResult(fn func(r Result) error) error {
+	if rpt.store != nil {
+		return rpt.store.eachResult(fn)
+	}
+
+	for _, r := range rpt.Results {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReferrersOf returns the sorted referrers of a URL
+func (rpt *Report) ReferrersOf(link string) ([]string, error) {
+	if rpt.store != nil {
+		return rpt.store.linkReferrers(link)
+	}
+
+	return rpt.Referrers[link], nil
+}
+
+// HrefsOf returns the sorted original links of a normalized URL
+func (rpt *Report) HrefsOf(link string) ([]string, error) {
+	if rpt.store != nil {
+		return rpt.store.linkHrefs(link)
+	}
+
+	return rpt.Hrefs[link], nil
+}
+
+// Close the disk store of the report, see Options.DiskStore. The results
+// cannot be read once closed.
+func (rpt *Report) Close() error {
+	if rpt.store == nil {
+		return nil
+	}
+
+	s := rpt.store
+	rpt.store = nil
+
+	return s.close()
+}
+
+// Normalize a link according to the options
+func (c *Crawler) normalize(link string) string {
+	return normalizeURL(link, c.opts.StripParams, c.opts.SortParams)
+}
+
+// Return the start URLs, URL first
+func (c *Crawler) startURLs() []string {
+	return append([]string{c.opts.URL}, c.opts.URLs...)
+}
+
+// Process queued links until the crawl is finished
+func (c *Crawler) worker(ctx context.Context) {
+	for {
+		t, ok := c.frontier.pop()
+		if !ok {
+			return
+		}
+
+		c.process(ctx, t)
+		c.frontier.done(t, ctx.Err() == nil)
+	}
+}
+
+// Add a result, calling OnResult if set
+func (c *Crawler) addResult(ctx context.Context, output Result, start time.Time) {
+	if ctx.Err() != nil {
+		// the request may have been aborted by the cancelled crawl, the link
+		// is processed again when resumed
+		return
+	}
+
+	c.checkSitemapURL(&output)
+
+	if err := c.store.addResult(output); err != nil {
+		c.frontier.abort(err)
+		return
+	}
+
+	failFastErrors := c.failFastErrors(output)
+
+	c.resultsMutex.Lock()
+	for _, i := range output.Issues {
+		if i.Severity == SeverityError {
+			c.errorsProcessed++
+		}
+	}
+	c.failFastProcessed += failFastErrors
+	failFast := c.opts.FailFastAfter > 0 && c.failFastProcessed >= c.opts.FailFastAfter
+	c.resultsMutex.Unlock()
+
+	if c.opts.OnResult != nil {
+		c.opts.OnResult(output, time.Since(start))
+	}
+
+	if failFast {
+		c.halt(TruncatedFailFastAfter)
+	}
+}
+
+// Return the number of errors of a result counted towards FailFastAfter
+func (c *Crawler) failFastErrors(r Result) int {
+	issues := r.Issues
+	if c.opts.FailFastIssues != nil {
+		issues = c.opts.FailFastIssues(r)
+	}
+
+	n := 0
+	for _, i := range issues {
+		if i.Severity == SeverityError {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Mark the crawl as truncated by a budget, keeping the first one
+func (c *Crawler) truncate(budget string) {
+	c.resultsMutex.Lock()
+	defer c.resultsMutex.Unlock()
+
+	if c.truncated == "" {
+		c.truncated = budget
+	}
+}
+
+// Stop the crawl gracefully when a budget is exceeded: no more links are
+// handed out, while in-flight requests are finished & reported. The remaining
+// links, and those found by the in-flight requests, are kept for the checkpoint.
+func (c *Crawler) halt(budget string) {
+	c.truncate(budget)
+
+	c.resultsMutex.Lock()
+	c.halted = true
+	c.resultsMutex.Unlock()
+
+	c.frontier.close()
+}
+
+// Return whether the crawl has been stopped by a budget
+func (c *Crawler) stopped() bool {
+	c.resultsMutex.Lock()
+	defer c.resultsMutex.Unlock()
+
+	return c.halted
+}
+
+// Return the budget which stopped the crawl early, if any
+func (c *Crawler) truncatedBy() string {
+	c.resultsMutex.Lock()
+	defer c.resultsMutex.Unlock()
+
+	return c.truncated
+}
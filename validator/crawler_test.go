@@ -0,0 +1,813 @@
+package validator_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/axllent/web-validator/validator"
+	"github.com/axllent/web-validator/validator/validatortest"
+)
+
+// Site of numbered pages, each linking to its children (2n & 2n+1), to the
+// first page and to a stylesheet, so most links are duplicates
+func treeSite(pages int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/style.css" {
+			w.Header().Set("Content-Type", "text/css")
+			fmt.Fprint(w, "body { color: red; }")
+			return
+		}
+
+		n := 1
+		if r.URL.Path != "/" {
+			var err error
+			if n, err = strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/p/")); err != nil || n < 1 || n > pages {
+				http.NotFound(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Page</title><link rel="stylesheet" href="/style.css"></head><body>`)
+		fmt.Fprint(w, `<a href="/">home</a>`)
+		for _, c := range []int{2 * n, 2*n + 1} {
+			if c <= pages {
+				fmt.Fprintf(w, `<a href="/p/%d">page %d</a>`, c, c)
+			}
+		}
+		fmt.Fprint(w, `</body></html>`)
+	})
+}
+
+// Return the depth of page n of the tree site
+func treeDepth(n int) int {
+	d := 0
+	for ; n > 1; n /= 2 {
+		d++
+	}
+	return d
+}
+
+// Crawl the handler with the context, without failing on the context error
+func crawl(t *testing.T, ctx context.Context, h http.Handler, opts validator.Options) *validator.Report {
+	t.Helper()
+
+	if opts.URL == "" {
+		opts.URL = validatortest.DefaultURL
+	}
+	opts.Transport = validatortest.Transport("web-validator.test", h)
+
+	c, err := validator.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rpt, err := c.Run(ctx)
+	if rpt != nil {
+		t.Cleanup(func() { _ = rpt.Close() })
+	}
+	if err != nil && ctx.Err() == nil {
+		t.Fatal(err)
+	}
+
+	return rpt
+}
+
+// Return the results of the report, from either store
+func results(t *testing.T, rpt *validator.Report) []validator.Result {
+	t.Helper()
+
+	list := []validator.Result{}
+	if err := rpt.EachResult(func(r validator.Result) error {
+		list = append(list, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return list
+}
+
+// Return the report as JSON, without the fields which differ every run. The
+// results, referrers & hrefs are read the same way for both stores.
+func reportJSON(t *testing.T, rpt *validator.Report) string {
+	t.Helper()
+
+	r := validator.Report{
+		LinksProcessed:    rpt.LinksProcessed,
+		ErrorsProcessed:   rpt.ErrorsProcessed,
+		WarningsProcessed: rpt.WarningsProcessed,
+		NoticesProcessed:  rpt.NoticesProcessed,
+		Interrupted:       rpt.Interrupted,
+		Truncated:         rpt.Truncated,
+		Results:           []validator.Result{},
+		Referrers:         make(map[string][]string),
+		Hrefs:             make(map[string][]string),
+	}
+
+	err := rpt.EachResult(func(res validator.Result) error {
+		r.Results = append(r.Results, res)
+
+		refs, err := rpt.ReferrersOf(res.URL)
+		if err != nil {
+			return err
+		}
+		r.Referrers[res.URL] = append([]string{}, refs...)
+
+		hrefs, err := rpt.HrefsOf(res.URL)
+		if len(hrefs) > 0 {
+			r.Hrefs[res.URL] = hrefs
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestCrawlDepths(t *testing.T) {
+	rpt := validatortest.Check(t, treeSite(40), validator.Options{MaxDepth: -1, NoRobots: true, Threads: 8})
+
+	if len(rpt.Results) != 41 {
+		t.Fatalf("expected 41 results, got %d", len(rpt.Results))
+	}
+
+	for _, r := range rpt.Results {
+		want := 0
+		switch {
+		case r.URL == validatortest.DefaultURL+"style.css":
+			// assets are linked from the first page they are found on
+			want = 1
+		case strings.HasPrefix(r.URL, validatortest.DefaultURL+"p/"):
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL, validatortest.DefaultURL+"p/"))
+			want = treeDepth(n)
+		}
+
+		if r.Depth != want {
+			t.Errorf("%s: expected depth %d, got %d", r.URL, want, r.Depth)
+		}
+	}
+}
+
+func TestCrawlMaxDepth(t *testing.T) {
+	rpt := validatortest.Check(t, treeSite(40), validator.Options{MaxDepth: 2, NoRobots: true, Threads: 8})
+
+	// the 7 pages up to depth 2 are parsed, the 8 links of depth 3 only
+	// checked, and the stylesheet
+	if len(rpt.Results) != 16 {
+		t.Fatalf("expected 16 results, got %d", len(rpt.Results))
+	}
+
+	// the stylesheet of the start URL is parsed beyond the max depth
+	rpt = validatortest.Check(t, treeSite(40), validator.Options{MaxDepth: 0, NoRobots: true})
+	for _, r := range rpt.Results {
+		if r.URL == validatortest.DefaultURL+"style.css" && (r.Depth != 1 || r.Type != "parse") {
+			t.Errorf("%s: expected a parsed stylesheet at depth 1, got %s at depth %d", r.URL, r.Type, r.Depth)
+		}
+	}
+}
+
+func TestCrawlMaxPages(t *testing.T) {
+	// the 3 pages & the stylesheet are parsed, duplicate links are not
+	// counted towards the budget
+	for _, tt := range []struct {
+		maxPages  int
+		truncated string
+	}{{4, ""}, {3, validator.TruncatedMaxPages}} {
+		rpt := crawl(t, context.Background(), treeSite(3), validator.Options{MaxDepth: -1, NoRobots: true, MaxPages: tt.maxPages})
+		if rpt.Truncated != tt.truncated {
+			t.Errorf("max pages %d: expected truncated %q, got %q", tt.maxPages, tt.truncated, rpt.Truncated)
+		}
+		if len(rpt.Results) != 4 {
+			t.Errorf("max pages %d: expected 4 results, got %d", tt.maxPages, len(rpt.Results))
+		}
+	}
+}
+
+func TestCrawlDedupe(t *testing.T) {
+	rpt := validatortest.Check(t, treeSite(40), validator.Options{MaxDepth: -1, NoRobots: true, Threads: 8})
+
+	seen := make(map[string]bool)
+	for _, r := range rpt.Results {
+		if seen[r.URL] {
+			t.Errorf("%s: reported more than once", r.URL)
+		}
+		seen[r.URL] = true
+	}
+
+	// every page links to the first page (but itself) & stylesheet
+	for u, want := range map[string]int{validatortest.DefaultURL: 39, validatortest.DefaultURL + "style.css": 40} {
+		if n := len(rpt.Referrers[u]); n != want {
+			t.Errorf("%s: expected %d referrers, got %d", u, want, n)
+		}
+	}
+}
+
+func TestCrawlThreads(t *testing.T) {
+	for _, disk := range []bool{false, true} {
+		want := ""
+		for _, threads := range []int{1, 3, 16} {
+			rpt := crawl(t, context.Background(), treeSite(100), validator.Options{MaxDepth: -1, NoRobots: true, Threads: threads, DiskStore: disk})
+
+			got := reportJSON(t, rpt)
+			if want == "" {
+				want = got
+			} else if got != want {
+				t.Errorf("disk store %v: report with %d threads differs", disk, threads)
+			}
+		}
+	}
+}
+
+func TestCrawlResume(t *testing.T) {
+	opts := validator.Options{MaxDepth: -1, NoRobots: true, Threads: 4}
+	want := reportJSON(t, crawl(t, context.Background(), treeSite(100), opts))
+
+	for _, disk := range []bool{false, true} {
+		for _, stopAfter := range []int64{1, 10, 50} {
+			opts := opts
+			opts.DiskStore = disk
+			opts.StateDir = t.TempDir()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			requests := int64(0)
+			site := treeSite(100)
+
+			// cancel the crawl from within a request
+			rpt := crawl(t, ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt64(&requests, 1) == stopAfter {
+					cancel()
+				}
+				site.ServeHTTP(w, r)
+			}), opts)
+			cancel()
+
+			if !rpt.Interrupted {
+				t.Fatalf("disk store %v, stopped after %d: not interrupted", disk, stopAfter)
+			}
+			if err := rpt.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			opts.Resume = true
+			got := reportJSON(t, crawl(t, context.Background(), site, opts))
+			if got != want {
+				t.Errorf("disk store %v, stopped after %d: resumed report differs", disk, stopAfter)
+			}
+		}
+	}
+
+	// links found by the requests in flight when a budget halts the crawl are
+	// crawled when resumed
+	started, served := make(chan struct{}), make(chan struct{})
+	halting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Home</title></head><body><a href="/missing">missing</a><a href="/slow">slow</a></body></html>`)
+		case "/missing":
+			// both links are in flight
+			<-started
+			close(served)
+			http.NotFound(w, r)
+		case "/slow":
+			// finish after the broken link has halted the crawl
+			close(started)
+			<-served
+			time.Sleep(200 * time.Millisecond)
+			fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Slow</title></head><body><a href="/child">child</a></body></html>`)
+		case "/child":
+			fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Child</title></head><body></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	for _, disk := range []bool{false, true} {
+		started, served = make(chan struct{}), make(chan struct{})
+		opts := validator.Options{MaxDepth: -1, NoRobots: true, Threads: 2, FailFastAfter: 1, DiskStore: disk, StateDir: t.TempDir()}
+
+		rpt := crawl(t, context.Background(), halting, opts)
+		if rpt.Truncated != validator.TruncatedFailFastAfter {
+			t.Fatalf("disk store %v: expected the crawl to be truncated, got %q", disk, rpt.Truncated)
+		}
+		if err := rpt.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		opts.FailFastAfter = 0
+		opts.Resume = true
+		urls := []string{}
+		for _, r := range results(t, crawl(t, context.Background(), halting, opts)) {
+			urls = append(urls, strings.TrimPrefix(r.URL, validatortest.DefaultURL))
+		}
+
+		if want := " child missing slow"; strings.Join(urls, " ") != want {
+			t.Errorf("disk store %v: expected %q, got %q", disk, want, strings.Join(urls, " "))
+		}
+	}
+}
+
+func TestCrawlSitemapBroken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<urlset><url><loc>/</loc></url><url><loc>/gone</loc></url></urlset>`)
+	})
+	mux.Handle("/", treeSite(1))
+
+	rpt := crawl(t, context.Background(), mux, validator.Options{MaxDepth: -1, NoRobots: true, Sitemap: "/sitemap.xml"})
+
+	// a broken link listed in the sitemap is a single error
+	if rpt.ErrorsProcessed != 1 {
+		t.Fatalf("expected 1 error, got %d", rpt.ErrorsProcessed)
+	}
+
+	for _, r := range rpt.Results {
+		if r.URL == validatortest.DefaultURL+"gone" && (len(r.Issues) != 1 || r.Issues[0].Code != "broken-link") {
+			t.Errorf("%s: expected a broken-link issue, got %v", r.URL, r.Issues)
+		}
+	}
+}
+
+func TestCrawlSitemapRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/sitemap.xml", http.RedirectHandler("/sitemap_index.xml", http.StatusMovedPermanently))
+	mux.HandleFunc("/sitemap_index.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<urlset><url><loc>/p/3</loc></url></urlset>`)
+	})
+	mux.Handle("/", treeSite(3))
+
+	// the redirected sitemap is read, even with redirect warnings
+	rpt := crawl(t, context.Background(), mux, validator.Options{MaxDepth: 0, NoRobots: true, RedirectWarnings: true, Sitemap: "/sitemap.xml"})
+
+	found := false
+	for _, r := range rpt.Results {
+		if r.Type == "sitemap" && len(r.Issues) > 0 {
+			t.Errorf("%s: expected the sitemap to be read, got %v", r.URL, r.Issues)
+		}
+		if r.URL == validatortest.DefaultURL+"p/3" && r.Type == "parse" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected the URL listed in the redirected sitemap to be parsed")
+	}
+}
+
+func TestCrawlSitemapMaxTime(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<sitemapindex><sitemap><loc>/slow.xml</loc></sitemap><sitemap><loc>/pages.xml</loc></sitemap></sitemapindex>`)
+	})
+	mux.HandleFunc("/slow.xml", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<urlset><url><loc>/a</loc></url></urlset>`)
+	})
+	mux.HandleFunc("/pages.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<urlset><url><loc>/b</loc></url></urlset>`)
+	})
+	mux.Handle("/", treeSite(1))
+
+	urls := func(rpt *validator.Report) string {
+		list := []string{}
+		for _, r := range results(t, rpt) {
+			list = append(list, strings.TrimPrefix(r.URL, validatortest.DefaultURL))
+		}
+		return strings.Join(list, " ")
+	}
+
+	opts := validator.Options{MaxDepth: -1, NoRobots: true, Sitemap: "/sitemap.xml"}
+	want := urls(crawl(t, context.Background(), mux, opts))
+
+	for _, disk := range []bool{false, true} {
+		opts := opts
+		opts.DiskStore = disk
+		opts.StateDir = t.TempDir()
+		opts.MaxTime = 50 * time.Millisecond
+
+		// the budget stops loading the sitemaps
+		rpt := crawl(t, context.Background(), mux, opts)
+		if rpt.Truncated != validator.TruncatedMaxTime {
+			t.Fatalf("disk store %v: expected the crawl to be truncated, got %q", disk, rpt.Truncated)
+		}
+		if got := urls(rpt); got != "sitemap.xml slow.xml" {
+			t.Errorf("disk store %v: expected the sitemaps read before the budget, got %q", disk, got)
+		}
+		if err := rpt.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the remaining sitemaps are read when resumed
+		opts.MaxTime = 0
+		opts.Resume = true
+		if got := urls(crawl(t, context.Background(), mux, opts)); got != want {
+			t.Errorf("disk store %v: expected %q, got %q", disk, want, got)
+		}
+	}
+}
+
+func TestCrawlFailFastIssues(t *testing.T) {
+	// the first page links to 10 broken pages
+	site := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Home</title></head><body>`)
+		for n := 1; n <= 10; n++ {
+			fmt.Fprintf(w, `<a href="/missing/%d">%d</a>`, n, n)
+		}
+		fmt.Fprint(w, `</body></html>`)
+	})
+
+	opts := validator.Options{NoRobots: true, Threads: 1, FailFastAfter: 3}
+	rpt := crawl(t, context.Background(), site, opts)
+	if rpt.Truncated != validator.TruncatedFailFastAfter {
+		t.Errorf("expected the crawl to be truncated, got %q", rpt.Truncated)
+	}
+
+	// known errors are not counted, but still reported
+	opts.FailFastIssues = func(r validator.Result) []validator.Issue {
+		if strings.Contains(r.URL, "/missing/") {
+			return nil
+		}
+		return r.Issues
+	}
+	rpt = crawl(t, context.Background(), site, opts)
+	if rpt.Truncated != "" || rpt.ErrorsProcessed != 10 {
+		t.Errorf("expected 10 errors & no truncation, got %d errors, truncated %q", rpt.ErrorsProcessed, rpt.Truncated)
+	}
+}
+
+func TestCrawlTrailingSlash(t *testing.T) {
+	// only serves the directory with a trailing slash
+	site := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Home</title></head><body><a href="/docs/">docs</a></body></html>`)
+		case "/docs/":
+			fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Docs</title></head><body><a href="/docs">docs</a><a href="/">home</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	for _, disk := range []bool{false, true} {
+		rpt := crawl(t, context.Background(), site, validator.Options{MaxDepth: -1, NoRobots: true, TrailingSlash: true, DiskStore: disk})
+
+		// the slash variants are the same page, requested as first seen
+		urls := []string{}
+		for _, r := range results(t, rpt) {
+			urls = append(urls, r.URL)
+			if len(r.Issues) > 0 {
+				t.Errorf("disk store %v: %s: unexpected issues %v", disk, r.URL, r.Issues)
+			}
+		}
+
+		if want := validatortest.DefaultURL + " " + validatortest.DefaultURL + "docs/"; strings.Join(urls, " ") != want {
+			t.Errorf("disk store %v: expected %s, got %s", disk, want, strings.Join(urls, " "))
+		}
+	}
+
+	// redirects to the trailing slash, which links to a broken page
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Home</title></head><body><a href="/docs">docs</a></body></html>`)
+		case "/docs":
+			http.Redirect(w, r, "/docs/", http.StatusMovedPermanently)
+		case "/docs/":
+			fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Docs</title></head><body><a href="/missing">missing</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	for _, disk := range []bool{false, true} {
+		rpt := crawl(t, context.Background(), redirect, validator.Options{MaxDepth: -1, NoRobots: true, RedirectWarnings: true, TrailingSlash: true, DiskStore: disk})
+
+		// the redirect target is requested, not a duplicate of the redirect
+		urls := []string{}
+		for _, r := range results(t, rpt) {
+			urls = append(urls, strings.TrimPrefix(r.URL, validatortest.DefaultURL))
+		}
+
+		if want := " docs docs/ missing"; strings.Join(urls, " ") != want {
+			t.Errorf("disk store %v: expected %q, got %q", disk, want, strings.Join(urls, " "))
+		}
+	}
+}
+
+// Transport serving the requests to every host with the handler
+type hostsTransport struct {
+	handler http.Handler
+}
+
+func (t hostsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return validatortest.Transport(req.URL.Host, t.handler).RoundTrip(req)
+}
+
+func TestCrawlScope(t *testing.T) {
+	// every page links to a child page, the first page links to pages in &
+	// out of the docs, a redirect out of the docs, and to other hosts
+	site := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch {
+		case r.URL.Path == "/docs/old":
+			http.Redirect(w, r, "/blog/new", http.StatusMovedPermanently)
+		case r.URL.Path == "/" && r.URL.Host == "web-validator.test":
+			fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Home</title></head><body>`)
+			for _, l := range []string{"/docs/a", "/blog/b", "/docs/old", "http://sub.web-validator.test/", "http://alias.test/"} {
+				fmt.Fprintf(w, `<a href="%s">link</a>`, l)
+			}
+			fmt.Fprint(w, `</body></html>`)
+		case strings.HasSuffix(r.URL.Path, "/child"):
+			fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Child</title></head><body></body></html>`)
+		default:
+			fmt.Fprintf(w, `<!doctype html><html lang="en"><head><title>Page</title></head><body><a href="%s">child</a></body></html>`, strings.TrimSuffix(r.URL.Path, "/")+"/child")
+		}
+	})
+
+	tests := []struct {
+		name string
+		opts validator.Options
+		// result types of the URLs, "-" if not requested
+		want map[string]string
+	}{
+		{"path prefix", validator.Options{PathPrefix: "/docs/"}, map[string]string{
+			"/docs/a": "parse", "/docs/a/child": "parse", "/blog/b": "", "/blog/b/child": "-",
+			"/docs/old": "parse", "/blog/new": "", "/blog/new/child": "-",
+		}},
+		{"include", validator.Options{Include: []string{"*/docs/*"}}, map[string]string{
+			"/docs/a": "parse", "/docs/a/child": "parse", "/blog/b": "", "/blog/b/child": "-",
+			"/docs/old": "parse", "/blog/new": "", "/blog/new/child": "-",
+		}},
+		{"no follow", validator.Options{NoFollow: []string{"*/docs/*"}}, map[string]string{
+			"/docs/a": "", "/docs/a/child": "-", "/blog/b": "parse", "/blog/b/child": "parse",
+			"/docs/old": "", "/blog/new": "", "/blog/new/child": "-",
+		}},
+		{"other hosts", validator.Options{}, map[string]string{
+			"http://sub.web-validator.test/": "-", "http://alias.test/": "-",
+		}},
+		{"subdomains", validator.Options{Subdomains: true}, map[string]string{
+			"http://sub.web-validator.test/": "parse", "http://sub.web-validator.test/child": "parse", "http://alias.test/": "-",
+		}},
+		{"hosts", validator.Options{Hosts: []string{"alias.test"}}, map[string]string{
+			"http://sub.web-validator.test/": "-", "http://alias.test/": "parse", "http://alias.test/child": "parse",
+		}},
+	}
+
+	for _, tt := range tests {
+		opts := tt.opts
+		opts.URL = validatortest.DefaultURL
+		opts.MaxDepth = -1
+		opts.NoRobots = true
+		opts.RedirectWarnings = true
+		opts.Transport = hostsTransport{site}
+
+		c, err := validator.New(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rpt, err := c.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make(map[string]string)
+		for _, r := range rpt.Results {
+			got[r.URL] = r.Type
+		}
+
+		for u, want := range tt.want {
+			if strings.HasPrefix(u, "/") {
+				u = strings.TrimSuffix(validatortest.DefaultURL, "/") + u
+			}
+			typ, ok := got[u]
+			if !ok {
+				typ = "-"
+			}
+			if typ != want {
+				t.Errorf("%s: %s: expected type %q, got %q", tt.name, u, want, typ)
+			}
+		}
+	}
+}
+
+func TestCrawlStartURLs(t *testing.T) {
+	// the hosts link to each other, and to another host
+	site := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Page</title></head><body>`)
+		switch r.URL.Host + r.URL.Path {
+		case "a.test/":
+			fmt.Fprint(w, `<a href="http://b.test/docs/">docs</a><a href="http://b.test/page">page</a><a href="http://c.test/">other</a>`)
+		case "b.test/docs/":
+			fmt.Fprint(w, `<a href="http://a.test/">home</a><a href="/page">page</a>`)
+		}
+		fmt.Fprint(w, `</body></html>`)
+	})
+
+	for _, disk := range []bool{false, true} {
+		opts := validator.Options{URL: "http://a.test/", URLs: []string{"http://b.test/docs/"}, MaxDepth: -1, NoRobots: true, DiskStore: disk, StateDir: t.TempDir(), Transport: hostsTransport{site}}
+
+		c, err := validator.New(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rpt, err := c.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = rpt.Close() })
+
+		// both start URLs are at depth 0, their hosts internal & other hosts outbound
+		got := []string{}
+		for _, r := range results(t, rpt) {
+			got = append(got, fmt.Sprintf("%s %s %d", r.URL, r.Type, r.Depth))
+		}
+
+		want := "http://a.test/ parse 0, http://b.test/docs/ parse 0, http://b.test/page parse 1"
+		if strings.Join(got, ", ") != want {
+			t.Errorf("disk store %v: expected %s, got %s", disk, want, strings.Join(got, ", "))
+		}
+
+		refs, err := rpt.ReferrersOf("http://b.test/page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(refs, " ") != "http://a.test/ http://b.test/docs/" {
+			t.Errorf("disk store %v: expected both start URLs as referrers, got %v", disk, refs)
+		}
+
+		if err := rpt.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the checkpoint is only resumed with the same start URLs
+		opts.URLs = nil
+		opts.Resume = true
+		c, err = validator.New(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "checkpoint is of another crawl") {
+			t.Errorf("disk store %v: expected resuming with other start URLs to fail, got %v", disk, err)
+		}
+	}
+}
+
+func TestCrawlTraps(t *testing.T) {
+	// endless pages, each linking twice to the next one
+	site := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		links := []string{}
+		switch {
+		case r.URL.Path == "/cal/":
+			links = []string{"/cal/1", "/cal/2", "/cal/3"}
+		case strings.HasPrefix(r.URL.Path, "/cal/"):
+			links = []string{"/cal/4", "/cal/4"}
+		case strings.HasPrefix(r.URL.Path, "/r/"):
+			links = []string{"r/", "r/"}
+		case strings.HasPrefix(r.URL.Path, "/l/"):
+			links = []string{"y/", "y/"}
+		case r.URL.Path == "/s":
+			p, _ := strconv.Atoi(r.URL.Query().Get("p"))
+			links = []string{fmt.Sprintf("/s?p=%d", p+1), fmt.Sprintf("/s?p=%d", p+1)}
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<!doctype html><html lang="en"><head><title>Page</title></head><body>`)
+		for _, l := range links {
+			fmt.Fprintf(w, `<a href="%s">next</a>`, l)
+		}
+		fmt.Fprint(w, `</body></html>`)
+	})
+
+	tests := []struct {
+		name  string
+		opts  validator.Options
+		start string
+		trap  string
+		refs  int
+	}{
+		{"page caps", validator.Options{PageCaps: map[string]int{"*/cal/*": 4}}, "cal/", "cal/4", 3},
+		{"repeats", validator.Options{MaxRepeats: 2}, "r/", "r/r/r/", 1},
+		{"length", validator.Options{MaxURLLength: len(validatortest.DefaultURL) + 6}, "l/", "l/y/y/y/", 1},
+		{"variants", validator.Options{MaxVariants: 2}, "s?p=1", "s?p=3", 1},
+	}
+
+	for _, tt := range tests {
+		for _, disk := range []bool{false, true} {
+			opts := tt.opts
+			opts.URL = validatortest.DefaultURL + tt.start
+			opts.MaxDepth = -1
+			opts.NoRobots = true
+			opts.DiskStore = disk
+			rpt := crawl(t, context.Background(), site, opts)
+
+			traps := []validator.Issue{}
+			for _, r := range results(t, rpt) {
+				for _, i := range r.Issues {
+					if i.Code == "crawler-trap" {
+						traps = append(traps, i)
+					}
+				}
+			}
+
+			// the trapped link is counted once, with all its referrers
+			if len(traps) != 1 || traps[0].Target != validatortest.DefaultURL+tt.trap || traps[0].Skipped != 1 {
+				t.Errorf("%s, disk store %v: expected 1 link skipped at %s, got %+v", tt.name, disk, tt.trap, traps)
+				continue
+			}
+
+			refs, err := rpt.ReferrersOf(traps[0].Target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(refs) != tt.refs {
+				t.Errorf("%s, disk store %v: expected %d referrers of %s, got %v", tt.name, disk, tt.refs, tt.trap, refs)
+			}
+		}
+	}
+}
+
+func TestCrawlLongLinks(t *testing.T) {
+	long := "/" + strings.Repeat("a", 40<<10)
+
+	// links longer than the keys of the disk store
+	site := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<!doctype html><html lang="en"><head><title>Home</title></head><body><a href="%s">long</a><a href="%s?b">long</a></body></html>`, long, long)
+		case long:
+			fmt.Fprintf(w, `<!doctype html><html lang="en"><head><title>Long</title></head><body><a href="%s?a">long</a></body></html>`, long)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	want := ""
+	for _, disk := range []bool{false, true} {
+		rpt := crawl(t, context.Background(), site, validator.Options{MaxDepth: -1, NoRobots: true, DiskStore: disk})
+
+		if n := len(results(t, rpt)); n != 4 {
+			t.Errorf("disk store %v: expected 4 results, got %d", disk, n)
+		}
+
+		got := reportJSON(t, rpt)
+		if want == "" {
+			want = got
+		} else if got != want {
+			t.Errorf("disk store %v: report differs", disk)
+		}
+	}
+}
+
+func TestCrawlValidationLines(t *testing.T) {
+	nu := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"messages":[
+			{"type":"error","firstLine":2,"lastLine":3,"firstColumn":40,"lastColumn":5,"message":"spans lines"},
+			{"type":"error","lastLine":4,"firstColumn":1,"lastColumn":9,"message":"single line"}
+		]}`)
+	}))
+	defer nu.Close()
+
+	rpt := crawl(t, context.Background(), treeSite(1), validator.Options{NoRobots: true, ValidateHTML: true, Validator: nu.URL})
+
+	lines := [][2]int{}
+	for _, r := range rpt.Results {
+		for _, i := range r.Issues {
+			lines = append(lines, [2]int{i.Validation.FirstLine, i.Validation.LastLine})
+		}
+	}
+
+	// Nu omits firstLine for messages on a single line
+	if fmt.Sprint(lines) != "[[2 3] [4 4]]" {
+		t.Errorf("expected lines [[2 3] [4 4]], got %v", lines)
+	}
+}
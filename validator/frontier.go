@@ -0,0 +1,185 @@
+package validator
+
+import (
+	"sync"
+)
+
+// number of tasks added to or claimed from the store at once
+const frontierBatch = 100
+
+// Queued link
+type task struct {
+	link     string
+	action   string
+	referer  string
+	depth    int
+	href     string // the link before it was normalized
+	redirect bool   // the link is the target of a redirect from the referer
+	scoped   bool   // a linked page, see Crawler.pageAction
+	id       uint64 // set when queued
+}
+
+// Frontier is the queue of links shared by the workers, crawled strictly
+// breadth-first. Links found by the workers are held back until every busy
+// worker is done, then the links of the lowest depth are sorted & admitted
+// as the next wave. This way a link is always first seen at its shortest
+// depth, and which duplicate wins does not depend on goroutine scheduling.
+type frontier struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	store  store
+	buffer []task // pending tasks not yet added to the store
+	queue  []task // tasks claimed from the store
+	busy   int
+	closed bool
+	err    error
+
+	// admit returns whether a task should be processed, called in wave order
+	admit func(t *task, seen seenLinks) bool
+}
+
+// Return a new frontier
+func newFrontier(s store, admit func(t *task, seen seenLinks) bool) *frontier {
+	f := &frontier{store: s, admit: admit}
+	f.cond = sync.NewCond(&f.mutex)
+	return f
+}
+
+// Add a task, it is queued with the next wave
+func (f *frontier) push(t task) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.buffer = append(f.buffer, t)
+
+	if len(f.buffer) >= frontierBatch {
+		f.flush()
+	}
+}
+
+// Add the buffered tasks to the store
+func (f *frontier) flush() {
+	if len(f.buffer) == 0 {
+		return
+	}
+
+	if err := f.store.push(f.buffer); err != nil {
+		f.fail(err)
+	}
+
+	f.buffer = nil
+}
+
+// Stop the crawl on a store error
+func (f *frontier) abort(err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.fail(err)
+}
+
+// Stop the crawl on a store error, while locked
+func (f *frontier) fail(err error) {
+	if f.err == nil {
+		f.err = err
+	}
+	f.closed = true
+	f.cond.Broadcast()
+}
+
+// Return the next task, blocking until one is available. Returns false once
+// the crawl is finished or the frontier is closed.
+func (f *frontier) pop() (task, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for !f.closed {
+		if len(f.queue) == 0 {
+			tasks, err := f.store.claim(frontierBatch)
+			if err != nil {
+				f.fail(err)
+				break
+			}
+			f.queue = tasks
+		}
+
+		if len(f.queue) > 0 {
+			t := f.queue[0]
+			f.queue[0] = task{}
+			f.queue = f.queue[1:]
+			f.busy++
+			return t, true
+		}
+
+		if f.busy > 0 {
+			// busy workers may add links to the next wave
+			f.cond.Wait()
+			continue
+		}
+
+		f.flush()
+
+		ok, err := f.store.nextWave(f.admit)
+		if err != nil {
+			f.fail(err)
+			break
+		}
+		if !ok {
+			break
+		}
+
+		f.cond.Broadcast()
+	}
+
+	// wake the other workers so they can exit too
+	f.cond.Broadcast()
+	return task{}, false
+}
+
+// Mark a popped task as done. Tasks which were not completed (aborted by a
+// cancelled crawl) stay in flight in the store, to be processed again when
+// the crawl is resumed.
+func (f *frontier) done(t task, completed bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if completed {
+		if err := f.store.finish(t); err != nil {
+			f.fail(err)
+		}
+	}
+
+	f.busy--
+	if f.busy == 0 {
+		f.cond.Broadcast()
+	}
+}
+
+// Close the frontier, no more tasks are handed out. Added tasks are kept for
+// the checkpoint.
+func (f *frontier) close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.closed = true
+	f.cond.Broadcast()
+}
+
+// Write a checkpoint of the store while no tasks can be added or admitted.
+// The metadata is read while locked too.
+func (f *frontier) checkpoint(meta func() checkpointMeta) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.flush()
+
+	return f.store.checkpoint(meta())
+}
+
+// Return the store error which stopped the crawl, if any
+func (f *frontier) error() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.err
+}
@@ -0,0 +1,106 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Issue severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityNotice  = "notice"
+)
+
+// Issue is a single problem found during the crawl
+type Issue struct {
+	Code       string           `json:"code"`
+	Severity   string           `json:"severity"`
+	Category   string           `json:"category"`
+	Source     string           `json:"source,omitempty"` // the page or sitemap the issue was found on, empty if the result itself or its referrers (see OnReferrers)
+	Target     string           `json:"target,omitempty"` // the URL the issue refers to
+	Message    string           `json:"message"`
+	Skipped    int              `json:"skipped,omitempty"` // the number of links skipped, of crawler-trap issues
+	Validation *ValidationError `json:"validation,omitempty"`
+}
+
+// IssueType is the category & default severity of a code
+type IssueType struct {
+	Code        string
+	Category    string
+	Severity    string
+	Description string
+}
+
+// IssueTypes by code. Codes are stable & used in reports, baselines and thresholds.
+var IssueTypes = []IssueType{
+	{"broken-link", "broken-link", SeverityError, "Link or resource returned an error status"},
+	{"request-failed", "broken-link", SeverityError, "Link or resource could not be requested"},
+	{"redirect", "redirect", SeverityError, "Link or resource redirects"},
+	{"mixed-content-file", "mixed-content", SeverityError, "HTTPS page loads a file over HTTP"},
+	{"mixed-content-css", "mixed-content", SeverityError, "HTTPS page loads a stylesheet over HTTP"},
+	{"mixed-content-script", "mixed-content", SeverityError, "HTTPS page loads a script over HTTP"},
+	{"mixed-content-favicon", "mixed-content", SeverityError, "HTTPS page links to a favicon over HTTP"},
+	{"mixed-content-image", "mixed-content", SeverityError, "HTTPS page links to an Open Graph image over HTTP"},
+	{"mixed-content-style", "mixed-content", SeverityError, "HTTPS stylesheet or style loads a resource over HTTP"},
+	{"html-validation", "validation", SeverityError, "HTML validation message"},
+	{"css-validation", "validation", SeverityError, "CSS validation message"},
+	{"parse-error", "validation", SeverityError, "HTML could not be parsed"},
+	{"validator-error", "validator-error", SeverityError, "Nu validator could not validate the page"},
+	{"body-too-large", "validator-error", SeverityWarning, "Page or stylesheet is too large to parse & validate"},
+	{"sitemap-error", "sitemap", SeverityError, "Sitemap could not be fetched or parsed"},
+	{"sitemap-broken", "sitemap", SeverityError, "URL listed in the sitemap does not return a 200 response"},
+	{"sitemap-missing", "sitemap", SeverityWarning, "Page is not listed in the sitemap"},
+	{"crawler-trap", "crawler-trap", SeverityWarning, "Pages skipped as a likely crawler trap"},
+}
+
+// IssueCategories of all issue types
+var IssueCategories = []string{"broken-link", "redirect", "mixed-content", "validation", "validator-error", "sitemap", "crawler-trap"}
+
+// Return a new issue with the category & default severity of the code
+func newIssue(code, source, target, message string) Issue {
+	i := Issue{
+		Code:     code,
+		Severity: SeverityError,
+		Source:   source,
+		Target:   target,
+		Message:  strings.TrimSpace(message),
+	}
+
+	for _, t := range IssueTypes {
+		if t.Code == code {
+			i.Category = t.Category
+			i.Severity = t.Severity
+			break
+		}
+	}
+
+	return i
+}
+
+// OnReferrers returns whether the issue is of a link, found on the pages
+// referring to the result (broken links & redirects) rather than on a page
+func (i Issue) OnReferrers() bool {
+	return i.Category == "broken-link" || i.Category == "redirect"
+}
+
+// Add an issue to the result
+func (r *Result) addIssue(i Issue) {
+	r.Issues = append(r.Issues, i)
+}
+
+// Add a request error issue to the result
+func (r *Result) addRequestError(err error) {
+	r.addIssue(newIssue("request-failed", "", r.URL, fmt.Sprintf("%s", err)))
+}
+
+// Add a status issue to the result
+func (r *Result) addStatusError() {
+	r.addIssue(newIssue("broken-link", "", r.URL, fmt.Sprintf("returned status %d", r.StatusCode)))
+}
+
+// Add a redirect issue to the result
+func (r *Result) addRedirect(location string) {
+	r.Redirect = location
+	r.addIssue(newIssue("redirect", "", r.URL, fmt.Sprintf("redirects to %s", location)))
+}
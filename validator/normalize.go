@@ -0,0 +1,135 @@
+package validator
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Normalize a link before it is queued. The scheme & host are lower-cased,
+// default ports, fragments & empty queries removed, an empty path set to /,
+// and percent-encoding normalized. Query parameters matching stripParams (wildcards allowed, eg:
+// utm_*) are removed, and the parameters are sorted if sortParams.
+func normalizeURL(link string, stripParams []string, sortParams bool) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+
+	if port := u.Port(); u.Scheme == "http" && port == "80" || u.Scheme == "https" && port == "443" {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	if u.Path == "" && u.Host != "" {
+		u.Path = "/"
+	}
+
+	escaped := normalizeEscapes(u.EscapedPath())
+	if p, err := url.PathUnescape(escaped); err == nil {
+		u.Path = p
+		u.RawPath = escaped
+	}
+
+	params := []string{}
+	for _, p := range strings.Split(u.RawQuery, "&") {
+		if p == "" || stripParam(paramName(p), stripParams) {
+			continue
+		}
+		params = append(params, normalizeEscapes(p))
+	}
+
+	if sortParams {
+		// by name only, so repeated parameters keep their order
+		sort.SliceStable(params, func(i, j int) bool {
+			return paramName(params[i]) < paramName(params[j])
+		})
+	}
+
+	u.RawQuery = strings.Join(params, "&")
+	u.ForceQuery = false
+
+	return u.String()
+}
+
+// Return the key of a link to find duplicates, the link without the trailing
+// slash if trailingSlash. Slash variants are requested as first seen, as a
+// server may only serve one of them.
+func dedupeKey(link string, trailingSlash bool) string {
+	if !trailingSlash {
+		return link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || len(u.Path) < 2 {
+		return link
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+
+	return u.String()
+}
+
+// Return the unescaped name of a query parameter
+func paramName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if n, err := url.QueryUnescape(name); err == nil {
+		return n
+	}
+	return name
+}
+
+// Whether a query parameter name matches any of the patterns
+func stripParam(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.TrimSpace(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize percent-encoding: unreserved characters are decoded, and the
+// hex digits of other escapes are upper-cased
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		hex := strings.ToUpper(s[i+1 : i+3])
+		c, err := url.PathUnescape("%" + hex)
+		if err != nil {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if isUnreserved(c[0]) {
+			b.WriteByte(c[0])
+		} else {
+			b.WriteString("%" + hex)
+		}
+		i += 2
+	}
+
+	return b.String()
+}
+
+// Whether a character is unreserved in URLs (RFC 3986)
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
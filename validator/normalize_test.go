@@ -0,0 +1,47 @@
+package validator
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		link       string
+		strip      []string
+		sortParams bool
+		want       string
+	}{
+		{"HTTP://Example.COM:80/a#top", nil, false, "http://example.com/a"},
+		{"https://example.com:443", nil, false, "https://example.com/"},
+		{"http://example.com:8080/a", nil, false, "http://example.com:8080/a"},
+		{"http://example.com/%7euser/a%2fb?", nil, false, "http://example.com/~user/a%2Fb"},
+		{"http://example.com/a?b=2&a=1", nil, false, "http://example.com/a?b=2&a=1"},
+		{"http://example.com/a?b=2&a=2&a=1", nil, true, "http://example.com/a?a=2&a=1&b=2"},
+		{"http://example.com/a?utm_source=x&b=2&fbclid=y&a=1", []string{"utm_*", "fbclid"}, true, "http://example.com/a?a=1&b=2"},
+		{"http://example.com/a?utm_source=x", []string{"utm_*"}, false, "http://example.com/a"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeURL(tt.link, tt.strip, tt.sortParams); got != tt.want {
+			t.Errorf("normalizeURL(%q, %q, %v) = %q, expected %q", tt.link, tt.strip, tt.sortParams, got, tt.want)
+		}
+	}
+}
+
+func TestDedupeKey(t *testing.T) {
+	tests := []struct {
+		link          string
+		trailingSlash bool
+		want          string
+	}{
+		{"http://example.com/docs/", false, "http://example.com/docs/"},
+		{"http://example.com/docs/", true, "http://example.com/docs"},
+		{"http://example.com/docs", true, "http://example.com/docs"},
+		{"http://example.com/docs/?a=1", true, "http://example.com/docs?a=1"},
+		{"http://example.com/", true, "http://example.com/"},
+	}
+
+	for _, tt := range tests {
+		if got := dedupeKey(tt.link, tt.trailingSlash); got != tt.want {
+			t.Errorf("dedupeKey(%q, %v) = %q, expected %q", tt.link, tt.trailingSlash, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// nuJSON response
+type nuJSON struct {
+	Messages []ValidationError `json:"messages"`
+	Source   struct {
+		Type     string `json:"type"`
+		Encoding string `json:"encoding"`
+		Code     string `json:"code"`
+	} `json:"source"`
+	Language string `json:"language"`
+}
+
+// ValidationError is a Nu validator message
+type ValidationError struct {
+	Type         string `json:"type"`
+	SubType      string `json:"subType,omitempty"`
+	FirstLine    int    `json:"firstLine"` // lastLine if not set by Nu
+	LastLine     int    `json:"lastLine"`
+	LastColumn   int    `json:"lastColumn"`
+	FirstColumn  int    `json:"firstColumn"`
+	Message      string `json:"message"`
+	Extract      string `json:"extract"`
+	HiliteStart  int    `json:"hiliteStart"`
+	HiliteLength int    `json:"hiliteLength"`
+}
+
+// Validate will validate HTML & CSS with Nu Validator
+func (c *Crawler) validate(ctx context.Context, output Result, body io.Reader, contentType string) Result {
+	if !strings.Contains(contentType, "text/html") && !strings.Contains(contentType, "text/css") {
+		return output
+	}
+
+	if !c.opts.ValidateHTML && strings.Contains(contentType, "text/html") {
+		return output
+	}
+
+	if !c.opts.ValidateCSS && strings.Contains(contentType, "text/css") {
+		return output
+	}
+
+	// Process only one request to validator at a time
+	c.validatorMutex.Lock()
+	defer c.validatorMutex.Unlock()
+
+	req, err := c.newRequest(ctx, "POST", c.opts.Validator, body)
+	if err != nil {
+		output.addIssue(newIssue("validator-error", "", "", fmt.Sprintf("Validator: %s", err)))
+		return output
+	}
+
+	req.Header.Set("User-Agent", "Web-validator")
+
+	if output.Type != "" {
+		req.Header.Set("Content-Type", contentType)
+	} else {
+		req.Header.Set("Content-Type", "text/html; charset=utf-8")
+	}
+
+	client := &http.Client{Transport: c.transport}
+	res, err := client.Do(req)
+	if err != nil {
+		output.addIssue(newIssue("validator-error", "", "", fmt.Sprintf("Validator: %s", err)))
+		return output
+	}
+
+	defer closeBody(res)
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		output.addIssue(newIssue("validator-error", "", "", fmt.Sprintf("Validator: %s", err)))
+		return output
+	}
+
+	if res.StatusCode != 200 {
+		output.addIssue(newIssue("validator-error", "", "", fmt.Sprintf("Validator: %s returned a %d (%s) response", c.opts.Validator, res.StatusCode, http.StatusText(res.StatusCode))))
+		return output
+	}
+
+	response := nuJSON{}
+	jsonErr := json.Unmarshal(data, &response)
+	if jsonErr != nil {
+		output.addIssue(newIssue("validator-error", "", "", fmt.Sprintf("Error parsing response from %s: %s", c.opts.Validator, string(data))))
+		return output
+	}
+
+	code := "html-validation"
+	if strings.Contains(contentType, "text/css") {
+		code = "css-validation"
+	}
+
+	for _, msg := range response.Messages {
+		if msg.Type == "error" || (c.opts.ShowWarnings && msg.Type == "info") {
+			i := newIssue(code, "", "", msg.Message)
+			if msg.Type != "error" {
+				i.Severity = SeverityNotice
+				if msg.SubType == "warning" {
+					i.Severity = SeverityWarning
+				}
+			}
+			m := msg
+			if m.FirstLine == 0 {
+				// Nu omits firstLine for messages on a single line
+				m.FirstLine = m.LastLine
+			}
+			i.Validation = &m
+			output.addIssue(i)
+		}
+	}
+
+	return output
+}
@@ -0,0 +1,426 @@
+package validator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/lukasbob/srcset"
+)
+
+var (
+	fileRegex = regexp.MustCompile(`(?i)\.(jpe?g|png|gif|svg|ico|pdf|swf|mp4|avi|mp3|ogg|mkv|docx?|xlsx?|zip|gz|bz2|tar|xz)$`)
+)
+
+// Add a link to the queue. Duplicates are removed when the link is admitted.
+func (c *Crawler) addQueueLink(ctx context.Context, httpLink, action, referer string, depth int) {
+	if c.beyondMaxDepth(depth) {
+		// prevent further parsing by simply doing a HEAD
+		action = "head"
+	}
+
+	c.queueLink(ctx, httpLink, action, referer, depth)
+}
+
+// Add a linked page to the queue, parsed if in scope (see pageAction)
+func (c *Crawler) addQueuePage(ctx context.Context, httpLink, referer string, depth int) {
+	action := c.pageAction(httpLink)
+	if c.beyondMaxDepth(depth) {
+		action = "head"
+	}
+
+	c.queueTask(ctx, task{link: httpLink, action: action, referer: referer, depth: depth, scoped: true})
+}
+
+// Whether links of this depth are beyond the max depth, to only be checked
+func (c *Crawler) beyondMaxDepth(depth int) bool {
+	return c.opts.MaxDepth != -1 && depth > c.opts.MaxDepth
+}
+
+// Add a link to the queue regardless of the max depth
+func (c *Crawler) queueLink(ctx context.Context, httpLink, action, referer string, depth int) {
+	c.queueTask(ctx, task{link: httpLink, action: action, referer: referer, depth: depth})
+}
+
+// Add the target of a redirect to the queue, regardless of the max depth as
+// the redirecting link was queued already. The target of a scoped page is
+// scoped too, while start URLs & stylesheets are parsed wherever they redirect.
+func (c *Crawler) queueRedirect(ctx context.Context, location, action, referer string, depth int, scoped bool) {
+	if scoped && action == "parse" {
+		action = c.pageAction(location)
+	}
+
+	c.queueTask(ctx, task{link: location, action: action, referer: referer, depth: depth, redirect: true, scoped: scoped})
+}
+
+// Add a task to the queue, normalizing its link
+func (c *Crawler) queueTask(ctx context.Context, t task) {
+	// links found after the crawl was halted by a budget are still queued, to
+	// be kept in the checkpoint as the frontier no longer hands them out
+	if ctx.Err() != nil || !c.robotsAllowed(t.link) {
+		return
+	}
+
+	// the original link, an empty query is not worth reporting
+	t.href = strings.TrimSuffix(t.link, "?")
+	t.link = c.normalize(t.link)
+
+	if matchesAny(c.ignoreMatches, t.link) {
+		return
+	}
+
+	isOutbound := c.isOutbound(t.link)
+
+	if isOutbound && !c.opts.CheckOutbound {
+		return
+	}
+
+	if isOutbound {
+		// outbound links are only checked, never parsed
+		t.action = "head"
+	}
+
+	// enforce HEAD - prevent validating common files HTML / CSS
+	if t.action == "parse" && fileRegex.MatchString(t.link) {
+		t.action = "head"
+	}
+
+	c.frontier.push(t)
+}
+
+// Admit a link from the frontier, returning false if it has been processed
+// already. Admitting is done by one goroutine at a time.
+func (c *Crawler) admit(t *task, seen seenLinks) bool {
+	// check if we have processed this already, requesting a duplicate as first seen
+	key := dedupeKey(t.link, c.opts.TrailingSlash)
+	link, processType, found := seen.weight(key)
+
+	// the first seen variant of a link redirecting to another variant (such
+	// as with a trailing slash) is not the same page, so the target is
+	// requested, once
+	slashRedirect := found && t.redirect && t.referer == link && t.link != link
+	if found && !slashRedirect {
+		t.link = link
+	}
+
+	// a page not parsed yet
+	newPage := t.action == "parse" && (!found || processType < actionWeight(t.action) || slashRedirect)
+
+	if newPage && c.opts.MaxPages > 0 && c.pagesProcessed >= c.opts.MaxPages {
+		// only check pages beyond the budget, like pages beyond the max depth
+		t.action = "head"
+		newPage = false
+		c.truncate(TruncatedMaxPages)
+	}
+
+	trapped := newPage && c.trapped(t)
+
+	// add to referrers
+	if t.referer != t.link {
+		seen.addReferrer(t.link, t.referer)
+	}
+
+	if t.href != "" && t.href != t.link {
+		seen.addHref(t.link, t.href)
+	}
+
+	weightLink, weight := t.link, actionWeight(t.action)
+	if slashRedirect {
+		// the redirecting variant is kept, so a redirect back is a duplicate
+		weightLink, weight = link, max(processType, weight)
+	}
+
+	if trapped {
+		// a trapped link is seen like a processed one, so it is skipped once
+		seen.setWeight(key, weightLink, weight)
+		return false
+	}
+
+	if found && processType >= actionWeight(t.action) && !slashRedirect {
+		return false
+	}
+
+	c.linksProcessed++
+	if t.action == "parse" {
+		c.pagesProcessed++
+	}
+
+	seen.setWeight(key, weightLink, weight)
+
+	if c.opts.OnProgress != nil {
+		c.resultsMutex.Lock()
+		errorsProcessed := c.errorsProcessed
+		c.resultsMutex.Unlock()
+		c.opts.OnProgress(t.link, c.linksProcessed, errorsProcessed)
+	}
+
+	return true
+}
+
+// Process a queued link
+func (c *Crawler) process(ctx context.Context, t task) {
+	if t.action == "parse" {
+		c.fetchAndParse(ctx, t.link, t.action, t.depth, t.scoped)
+	} else {
+		c.head(ctx, t.link, t.depth)
+	}
+}
+
+// FetchAndParse will request the URL and parse it. Scoped is set for linked
+// pages, see queueRedirect.
+func (c *Crawler) fetchAndParse(ctx context.Context, httpLink, action string, depth int, scoped bool) {
+	start := time.Now()
+	output := Result{}
+	output.URL = httpLink
+	output.Type = action
+	output.Depth = depth
+
+	req, err := c.newRequest(ctx, "GET", httpLink, nil)
+	if err != nil {
+		output.addRequestError(err)
+		c.addResult(ctx, output, start)
+		return
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		if res != nil {
+			loc := res.Header.Get("Location")
+			output.StatusCode = res.StatusCode
+			if loc != "" {
+				full, err := absoluteURL(loc, httpLink)
+				if err == nil {
+					output.addRedirect(full)
+					c.addResult(ctx, output, start)
+					// the redirecting link was within the max depth, or a stylesheet
+					c.queueRedirect(ctx, full, action, httpLink, depth, scoped)
+					return
+				}
+			}
+		}
+		output.addRequestError(err)
+		c.addResult(ctx, output, start)
+		return
+	}
+
+	defer closeBody(res)
+
+	output.StatusCode = res.StatusCode
+
+	if res.StatusCode != 200 {
+		output.addStatusError()
+		c.addResult(ctx, output, start)
+		return
+	}
+
+	// read the body to create two separate readers
+	body, err := io.ReadAll(io.LimitReader(res.Body, c.opts.MaxBodySize+1))
+	if err != nil {
+		output.addRequestError(err)
+		c.addResult(ctx, output, start)
+		return
+	}
+
+	if int64(len(body)) > c.opts.MaxBodySize {
+		output.addIssue(newIssue("body-too-large", "", "", fmt.Sprintf("larger than %d bytes, not parsed or validated", c.opts.MaxBodySize)))
+		c.addResult(ctx, output, start)
+		return
+	}
+
+	// HTML
+	if strings.Contains(res.Header.Get("Content-Type"), "text/html") {
+		if c.missingFromSitemap(httpLink) {
+			output.addIssue(newIssue("sitemap-missing", "", httpLink, "page is not listed in the sitemap"))
+		}
+
+		// create separate *Reader for NuValidation
+		r := bytes.NewReader(body)
+		// validate the HTML
+		output = c.validate(ctx, output, r, res.Header.Get("Content-Type"))
+
+		// create a new reader
+		r2 := bytes.NewReader(body)
+
+		// Load the HTML document
+		doc, err := goquery.NewDocumentFromReader(r2)
+		if err != nil {
+			output.addIssue(newIssue("parse-error", "", "", fmt.Sprintf("%s", err)))
+			c.addResult(ctx, output, start)
+			return
+		}
+
+		// CHECK FOR BASE
+		baseLink := httpLink
+
+		doc.Find("base").Each(func(i int, s *goquery.Selection) {
+			if link, ok := s.Attr("href"); ok {
+				full, err := absoluteURL(link, httpLink)
+				if err == nil {
+					baseLink = full
+				}
+			}
+		})
+
+		// IMAGES/VIDEOS/AUDIO/IFRAME
+		doc.Find("img,embed,source,iframe").Each(func(i int, s *goquery.Selection) {
+			if link, ok := s.Attr("src"); ok {
+				full, err := absoluteURL(link, baseLink)
+				if err != nil {
+					return
+				}
+				if isMixedContent(httpLink, full) {
+					output.addIssue(newIssue("mixed-content-file", "", full, fmt.Sprintf("Mixed content to file: %s", full)))
+				}
+				// parse iframes as html, they are a link to another page
+				if goquery.NodeName(s) == "iframe" {
+					c.addQueuePage(ctx, full, httpLink, depth+1)
+				} else {
+					c.addQueueLink(ctx, full, "head", httpLink, depth+1)
+				}
+			}
+
+			if link, ok := s.Attr("srcset"); ok {
+				// srcset may contain multiple urls
+				srcLinks := srcset.Parse(link)
+				for _, src := range srcLinks {
+					link := src.URL
+					full, err := absoluteURL(link, baseLink)
+					if err != nil {
+						return
+					}
+					if isMixedContent(httpLink, full) {
+						output.addIssue(newIssue("mixed-content-file", "", full, fmt.Sprintf("Mixed content to file: %s", full)))
+					}
+					c.addQueueLink(ctx, full, "head", httpLink, depth+1)
+				}
+			}
+		})
+
+		// CSS
+		doc.Find("link[rel=\"stylesheet\"]").Each(func(i int, s *goquery.Selection) {
+			if link, ok := s.Attr("href"); ok {
+				full, err := absoluteURL(link, baseLink)
+				if err != nil {
+					return
+				}
+				if isMixedContent(baseLink, full) {
+					output.addIssue(newIssue("mixed-content-css", "", full, fmt.Sprintf("Mixed content link to CSS: %s", full)))
+				}
+				// parsed & validated with the page, even beyond the max depth
+				c.queueLink(ctx, full, "parse", httpLink, depth+1)
+			}
+		})
+
+		// JS
+		doc.Find("script").Each(func(i int, s *goquery.Selection) {
+			if link, ok := s.Attr("src"); ok {
+				full, err := absoluteURL(link, baseLink)
+				if err != nil {
+					return
+				}
+				if isMixedContent(baseLink, full) {
+					output.addIssue(newIssue("mixed-content-script", "", full, fmt.Sprintf("Mixed content to JS: %s", full)))
+				}
+				c.addQueueLink(ctx, full, "head", httpLink, depth+1)
+			}
+		})
+
+		// FAVICONS
+		doc.Find("link[rel=\"icon\"], link[rel=\"shortcut icon\"], link[rel=\"apple-touch-icon\"]").Each(func(i int, s *goquery.Selection) {
+			if link, ok := s.Attr("href"); ok {
+				full, err := absoluteURL(link, baseLink)
+				if err != nil {
+					return
+				}
+				if isMixedContent(baseLink, full) {
+					output.addIssue(newIssue("mixed-content-favicon", "", full, fmt.Sprintf("Mixed content to favicon: %s", full)))
+				}
+				c.addQueueLink(ctx, full, "head", httpLink, depth+1)
+			}
+		})
+
+		// OPEN GRAPH IMAGES
+		doc.Find("meta[property$=\":image\"], meta[name$=\":image\"]").Each(func(i int, s *goquery.Selection) {
+			if link, ok := s.Attr("content"); ok {
+				full, err := absoluteURL(link, baseLink)
+				if err != nil {
+					return
+				}
+				if isMixedContent(baseLink, full) {
+					output.addIssue(newIssue("mixed-content-image", "", full, fmt.Sprintf("Mixed content to Open Graph image: %s", full)))
+				}
+				c.addQueueLink(ctx, full, "head", httpLink, depth+1)
+			}
+		})
+
+		// LINKS
+		doc.Find("a").Each(func(i int, s *goquery.Selection) {
+			if link, ok := s.Attr("href"); ok {
+				full, err := absoluteURL(link, baseLink)
+				if err != nil {
+					return
+				}
+
+				c.addQueuePage(ctx, full, httpLink, depth+1)
+			}
+		})
+
+		// INLINE STYLE BLOCKS
+		doc.Find("style").Each(func(i int, s *goquery.Selection) {
+			raw := s.Text()
+			for _, link := range extractStyleURLs(raw) {
+				full, err := absoluteURL(link, baseLink)
+				if err != nil {
+					break
+				}
+				if isMixedContent(httpLink, full) {
+					output.addIssue(newIssue("mixed-content-style", "", full, fmt.Sprintf("Mixed content from CSS: %s", full)))
+				}
+				c.addQueueLink(ctx, full, "head", httpLink, depth+1)
+			}
+		})
+
+		// INLINE STYLES
+		doc.Find("*[style]").Each(func(i int, s *goquery.Selection) {
+			if style, ok := s.Attr("style"); ok {
+				for _, link := range extractStyleURLs(style) {
+					full, err := absoluteURL(link, baseLink)
+					if err != nil {
+						return
+					}
+					if isMixedContent(httpLink, full) {
+						output.addIssue(newIssue("mixed-content-style", "", full, fmt.Sprintf("Mixed content from CSS: %s", full)))
+					}
+					c.addQueueLink(ctx, full, "head", httpLink, depth+1)
+				}
+			}
+		})
+
+	}
+
+	// CSS
+	if strings.Contains(res.Header.Get("Content-Type"), "text/css") {
+		// create separate *Reader for NuValidation
+		r := bytes.NewReader(body)
+		// validate the CSS
+		output = c.validate(ctx, output, r, res.Header.Get("Content-Type"))
+
+		for _, link := range extractStyleURLs(string(body)) {
+			full, err := absoluteURL(link, httpLink)
+			if err != nil {
+				continue
+			}
+			if isMixedContent(httpLink, full) {
+				output.addIssue(newIssue("mixed-content-style", "", full, fmt.Sprintf("Mixed content from CSS: %s", full)))
+			}
+			c.addQueueLink(ctx, full, "head", httpLink, depth+1)
+		}
+	}
+
+	c.addResult(ctx, output, start)
+}
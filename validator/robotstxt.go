@@ -0,0 +1,84 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/jimsmart/grobotstxt"
+)
+
+// maximum size of robots.txt read, the rest is ignored
+const maxRobotsSize = 500 << 10
+
+// Set up robots.txt exclusions of the internal hosts of the start URLs, if
+// allowed and exists. Robots.txt is read for its Sitemap directives too.
+func (c *Crawler) initRobotsTxt(ctx context.Context) {
+	if c.opts.NoRobots && c.opts.Sitemap != SitemapAuto {
+		return
+	}
+
+	for _, startURL := range c.startURLs() {
+		uri, err := url.Parse(startURL)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := c.robots[uri.Host]; ok {
+			continue
+		}
+
+		robotsURL := fmt.Sprintf("%s://%s/robots.txt", uri.Scheme, uri.Host)
+
+		if content, ok := c.fetchRobotsTxt(ctx, robotsURL); ok {
+			c.robots[uri.Host] = content
+		}
+	}
+}
+
+// Fetch a robots.txt, returning false if it does not exist
+func (c *Crawler) fetchRobotsTxt(ctx context.Context, robotsURL string) (string, bool) {
+	client := http.Client{
+		Transport: c.transport,
+		Timeout:   c.opts.Timeout,
+	}
+
+	req, err := c.newRequest(ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return "", false
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", false
+	}
+
+	defer closeBody(res)
+
+	if res.StatusCode != 200 {
+		return "", false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxRobotsSize))
+	if err != nil {
+		return "", false
+	}
+
+	return string(body), true
+}
+
+// Test if allowed in robots.txt of the host, if any
+func (c *Crawler) robotsAllowed(url string) bool {
+	if c.opts.NoRobots {
+		return true
+	}
+
+	content, ok := c.robots[getHost(url)]
+	if !ok {
+		return true
+	}
+
+	return grobotstxt.AgentAllowed(content, "web-validator", url)
+}
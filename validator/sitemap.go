@@ -0,0 +1,223 @@
+package validator
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SitemapAuto uses the Sitemap directives of the robots.txt of each start URL
+// host, or its /sitemap.xml if there are none
+const SitemapAuto = "auto"
+
+// maximum uncompressed size of a sitemap (see sitemaps.org)
+const maxSitemapSize = 50 << 20
+
+// maximum number of sitemaps read, including those listed in sitemap indexes
+const maxSitemaps = 1000
+
+// Sitemap or sitemap index
+type sitemapXML struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// Load the sitemaps, queuing the URLs listed. Each sitemap is added as a
+// result, with a sitemap-error issue if it could not be read. Sitemaps read by
+// previous runs are only read for their URLs when resumed, and loading stops
+// once halted by a budget, the rest being read when resumed.
+func (c *Crawler) loadSitemaps(ctx context.Context) {
+	c.sitemapURLs = make(map[string]string)
+
+	queue := []string{}
+
+	if c.opts.Sitemap == SitemapAuto {
+		hosts := make(map[string]bool)
+		for _, startURL := range c.startURLs() {
+			host := getHost(startURL)
+			if hosts[host] {
+				continue
+			}
+			hosts[host] = true
+
+			sitemaps := robotsSitemaps(c.robots[host])
+			if len(sitemaps) == 0 {
+				if s, err := absoluteURL("/sitemap.xml", startURL); err == nil {
+					sitemaps = append(sitemaps, s)
+				}
+			}
+			queue = append(queue, sitemaps...)
+		}
+	} else if s, err := absoluteURL(c.opts.Sitemap, c.opts.URL); err == nil {
+		queue = append(queue, s)
+	}
+
+	seen := make(map[string]bool)
+
+	for len(queue) > 0 && len(seen) < maxSitemaps && ctx.Err() == nil {
+		sitemapURL := queue[0]
+		queue = queue[1:]
+
+		if seen[sitemapURL] {
+			continue
+		}
+		seen[sitemapURL] = true
+
+		read := len(seen) <= c.sitemapsRead
+		if !read && c.stopped() {
+			break
+		}
+
+		start := time.Now()
+		output := Result{URL: sitemapURL, Type: "sitemap"}
+
+		sm, err := c.fetchSitemap(ctx, &output)
+		if err != nil {
+			output.addIssue(newIssue("sitemap-error", "", sitemapURL, fmt.Sprintf("%s", err)))
+		}
+
+		if !read {
+			c.addResult(ctx, output, start)
+			c.sitemapsRead++
+		}
+
+		if err != nil {
+			continue
+		}
+
+		for _, s := range sm.Sitemaps {
+			if loc, err := absoluteURL(strings.TrimSpace(s.Loc), sitemapURL); err == nil {
+				queue = append(queue, loc)
+			}
+		}
+
+		for _, u := range sm.URLs {
+			loc, err := absoluteURL(strings.TrimSpace(u.Loc), sitemapURL)
+			if err != nil {
+				continue
+			}
+			loc = c.normalize(loc)
+
+			if _, ok := c.sitemapURLs[loc]; ok {
+				continue
+			}
+			c.sitemapURLs[loc] = sitemapURL
+
+			if !read {
+				c.addQueuePage(ctx, loc, sitemapURL, 0)
+			}
+		}
+	}
+}
+
+// Fetch & parse a sitemap, gzipped or not
+func (c *Crawler) fetchSitemap(ctx context.Context, output *Result) (sitemapXML, error) {
+	sm := sitemapXML{}
+
+	req, err := c.newRequest(ctx, "GET", output.URL, nil)
+	if err != nil {
+		return sm, err
+	}
+
+	// sitemaps are followed when redirected, even with redirect warnings
+	client := http.Client{
+		Transport: c.transport,
+		Timeout:   c.opts.Timeout,
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return sm, err
+	}
+
+	defer closeBody(res)
+
+	output.StatusCode = res.StatusCode
+
+	if res.StatusCode != 200 {
+		return sm, fmt.Errorf("returned status %d", res.StatusCode)
+	}
+
+	var r io.Reader = bufio.NewReader(res.Body)
+
+	// gzipped sitemaps, unless already decompressed by the transport
+	if magic, err := r.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return sm, err
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	}
+
+	if err := xml.NewDecoder(io.LimitReader(r, maxSitemapSize)).Decode(&sm); err != nil {
+		return sm, fmt.Errorf("error parsing sitemap: %s", err)
+	}
+
+	return sm, nil
+}
+
+// Return the URLs of the Sitemap directives of robots.txt
+func robotsSitemaps(robots string) []string {
+	sitemaps := []string{}
+
+	for _, line := range strings.Split(robots, "\n") {
+		// remove comments
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(k), "sitemap") {
+			continue
+		}
+
+		if v = strings.TrimSpace(v); v != "" {
+			sitemaps = append(sitemaps, v)
+		}
+	}
+
+	return sitemaps
+}
+
+// Add a sitemap-broken issue if a URL listed in the sitemap did not return a
+// 200, unless it is already reported as a broken link
+func (c *Crawler) checkSitemapURL(output *Result) {
+	sitemapURL, ok := c.sitemapURLs[output.URL]
+	if !ok || output.Type == "sitemap" || output.Type == "trap" || output.StatusCode == 200 {
+		return
+	}
+
+	for _, i := range output.Issues {
+		if i.Category == "broken-link" {
+			return
+		}
+	}
+
+	msg := "listed in the sitemap but could not be requested"
+	if output.StatusCode > 0 {
+		msg = fmt.Sprintf("listed in the sitemap but returned status %d", output.StatusCode)
+	}
+
+	output.addIssue(newIssue("sitemap-broken", sitemapURL, output.URL, msg))
+}
+
+// Whether a page is missing from the sitemap, only if the sitemap lists any URLs
+func (c *Crawler) missingFromSitemap(httpLink string) bool {
+	if len(c.sitemapURLs) == 0 {
+		return false
+	}
+
+	_, ok := c.sitemapURLs[httpLink]
+	return !ok
+}
@@ -0,0 +1,235 @@
+package validator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// checkpoint file of the in-memory store in the state directory
+const checkpointFile = "checkpoint.json"
+
+// Checkpoint of the in-memory store
+type checkpoint struct {
+	Version int `json:"version"`
+	checkpointMeta
+	Admitted  []checkpointTask    `json:"admitted"`
+	Pending   []checkpointTask    `json:"pending"`
+	Processed map[string]int      `json:"processed"`
+	Canonical map[string]string   `json:"canonical,omitempty"`
+	Referrers map[string][]string `json:"referrers"`
+	Hrefs     map[string][]string `json:"hrefs,omitempty"`
+	Results   []Result            `json:"results"`
+}
+
+// Checkpoint task
+type checkpointTask struct {
+	Link     string `json:"link"`
+	Action   string `json:"action"`
+	Referer  string `json:"referer,omitempty"`
+	Depth    int    `json:"depth"`
+	Href     string `json:"href,omitempty"`
+	Redirect bool   `json:"redirect,omitempty"`
+	Scoped   bool   `json:"scoped,omitempty"`
+}
+
+// Return the checkpoint task of a task
+func newCheckpointTask(t task) checkpointTask {
+	return checkpointTask{Link: t.link, Action: t.action, Referer: t.referer, Depth: t.depth, Href: t.href, Redirect: t.redirect, Scoped: t.scoped}
+}
+
+// Return the task of a checkpoint task
+func (t checkpointTask) task() task {
+	return task{link: t.Link, action: t.Action, referer: t.Referer, depth: t.Depth, href: t.Href, redirect: t.Redirect, scoped: t.Scoped}
+}
+
+// Return the result key of a task, to check whether it has completed
+func resultKey(link, resultType string) string {
+	return link + "\x00" + resultType
+}
+
+// Return the result type of a task
+func (t task) resultType() string {
+	if t.action == "parse" {
+		return t.action
+	}
+	return ""
+}
+
+// Write a checkpoint of the crawl to the state directory
+func (c *Crawler) writeCheckpoint(elapsed time.Duration) error {
+	return c.frontier.checkpoint(func() checkpointMeta {
+		return checkpointMeta{
+			URLs:           c.startURLs(),
+			Elapsed:        c.elapsed + elapsed.Seconds(),
+			LinksProcessed: c.linksProcessed,
+			PagesProcessed: c.pagesProcessed,
+			Traps:          c.traps,
+			SitemapsRead:   c.sitemapsRead,
+		}
+	})
+}
+
+// Load the checkpoint from the store, returning false if there is none
+func (c *Crawler) loadCheckpoint() (bool, error) {
+	meta, ok, err := c.store.restore()
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if !slices.Equal(meta.URLs, c.startURLs()) {
+		return false, fmt.Errorf("checkpoint is of another crawl: %s", strings.Join(meta.URLs, " "))
+	}
+
+	c.elapsed = meta.Elapsed
+	c.linksProcessed = meta.LinksProcessed
+	c.pagesProcessed = meta.PagesProcessed
+	c.sitemapsRead = meta.SitemapsRead
+	if meta.Traps != nil {
+		c.traps = newTrapState()
+		for k, v := range meta.Traps.Variants {
+			c.traps.Variants[k] = v
+		}
+		for k, v := range meta.Traps.Capped {
+			c.traps.Capped[k] = v
+		}
+		for k, v := range meta.Traps.Found {
+			c.traps.Found[k] = v
+		}
+	}
+
+	err = c.store.eachResult(func(r Result) error {
+		for _, i := range r.Issues {
+			if i.Severity == SeverityError {
+				c.errorsProcessed++
+			}
+		}
+		c.failFastProcessed += c.failFastErrors(r)
+		return nil
+	})
+
+	return true, err
+}
+
+func (s *memoryStore) checkpoint(meta checkpointMeta) error {
+	if s.stateDir == "" {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cp := checkpoint{
+		Version:        1,
+		checkpointMeta: meta,
+		Admitted:       []checkpointTask{},
+		Pending:        []checkpointTask{},
+		Processed:      s.processed,
+		Canonical:      s.canonical,
+		Referrers:      s.refs,
+		Hrefs:          s.originals,
+		Results:        s.results,
+	}
+
+	ids := []uint64{}
+	for id := range s.inflight {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		cp.Admitted = append(cp.Admitted, newCheckpointTask(s.inflight[id]))
+	}
+	for _, t := range s.queue {
+		cp.Admitted = append(cp.Admitted, newCheckpointTask(t))
+	}
+	for _, t := range s.pending {
+		cp.Pending = append(cp.Pending, newCheckpointTask(t))
+	}
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(s.stateDir, checkpointFile), data)
+}
+
+func (s *memoryStore) restore() (checkpointMeta, bool, error) {
+	if s.stateDir == "" {
+		return checkpointMeta{}, false, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.stateDir, checkpointFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpointMeta{}, false, nil
+	}
+	if err != nil {
+		return checkpointMeta{}, false, err
+	}
+
+	cp := checkpoint{}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return checkpointMeta{}, false, fmt.Errorf("error parsing checkpoint: %s", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.results = cp.Results
+	if cp.Processed != nil {
+		s.processed = cp.Processed
+	}
+	if cp.Canonical != nil {
+		s.canonical = cp.Canonical
+	}
+	if cp.Referrers != nil {
+		s.refs = cp.Referrers
+	}
+	if cp.Hrefs != nil {
+		s.originals = cp.Hrefs
+	}
+
+	done := make(map[string]bool)
+	for _, r := range s.results {
+		done[resultKey(r.URL, r.Type)] = true
+	}
+
+	// skip the in-flight tasks which completed before the checkpoint was written
+	for _, ct := range cp.Admitted {
+		t := ct.task()
+		if done[resultKey(t.link, t.resultType())] {
+			continue
+		}
+		s.nextID++
+		t.id = s.nextID
+		s.queue = append(s.queue, t)
+	}
+
+	for _, ct := range cp.Pending {
+		s.pending = append(s.pending, ct.task())
+	}
+
+	return cp.checkpointMeta, true, nil
+}
+
+// Write a file via a temporary file, so an interrupted write never leaves a
+// broken file behind
+func writeFileAtomic(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
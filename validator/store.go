@@ -0,0 +1,292 @@
+package validator
+
+import (
+	"sort"
+	"sync"
+
+	"golang.org/x/exp/slices"
+)
+
+// Store of the crawl: the frontier (pending, queued & in-flight links), the
+// links seen with their referrers, and the results. The crawl state is kept
+// in memory, or on disk for very large sites (see Options.DiskStore).
+type store interface {
+	// add pending tasks, admitted with a later wave
+	push(tasks []task) error
+	// admit the pending tasks of the lowest depth to the queue, in wave
+	// order. Returns false if there are no pending tasks.
+	nextWave(admit func(t *task, seen seenLinks) bool) (bool, error)
+	// take up to n queued tasks, they are in flight until finished
+	claim(n int) ([]task, error)
+	// remove a completed in-flight task
+	finish(t task) error
+	// add a result
+	addResult(r Result) error
+	// call fn for each result, sorted by URL & type
+	eachResult(fn func(r Result) error) error
+	// return the referrers of every link seen
+	referrers() (map[string][]string, error)
+	// return the original hrefs of the normalized links
+	hrefs() (map[string][]string, error)
+	// return the sorted referrers of a link, nil if it was not seen
+	linkReferrers(link string) ([]string, error)
+	// return the sorted original hrefs of a normalized link, nil if none
+	// were added
+	linkHrefs(link string) ([]string, error)
+	// write a checkpoint, to be restored when resumed
+	checkpoint(meta checkpointMeta) error
+	// restore the last checkpoint, returning false if there is none.
+	// In-flight tasks are queued again.
+	restore() (checkpointMeta, bool, error)
+	// close the store
+	close() error
+}
+
+// Links seen by the crawl by their dedupe key, only used while admitting a wave
+type seenLinks interface {
+	// return the link & action weight a key was admitted with, if found
+	weight(key string) (string, int, bool)
+	// set the link & action weight of a key
+	setWeight(key, link string, weight int)
+	// add a referrer of a link, or only the link if the referer is empty
+	addReferrer(link, referer string)
+	// add an original href of a normalized link
+	addHref(link, href string)
+}
+
+// Checkpoint metadata of the crawl
+type checkpointMeta struct {
+	URLs           []string   `json:"urls"`    // the start URLs
+	Elapsed        float64    `json:"elapsed"` // seconds
+	LinksProcessed int        `json:"linksProcessed"`
+	PagesProcessed int        `json:"pagesProcessed"`
+	Traps          *trapState `json:"traps,omitempty"`
+	SitemapsRead   int        `json:"sitemapsRead,omitempty"`
+}
+
+// Sort tasks in wave order: depth, link, parse before head (so a link is
+// only requested once), referer and href
+func sortTasks(tasks []task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		if a.depth != b.depth {
+			return a.depth < b.depth
+		}
+		if a.link != b.link {
+			return a.link < b.link
+		}
+		if actionWeight(a.action) != actionWeight(b.action) {
+			return actionWeight(a.action) > actionWeight(b.action)
+		}
+		if a.referer != b.referer {
+			return a.referer < b.referer
+		}
+		return a.href < b.href
+	})
+}
+
+// Sort results by URL & type
+func sortResults(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].URL != results[j].URL {
+			return results[i].URL < results[j].URL
+		}
+		return results[i].Type < results[j].Type
+	})
+}
+
+// In-memory store
+type memoryStore struct {
+	mutex     sync.Mutex
+	stateDir  string // checkpoints are written here, if set
+	pending   []task
+	queue     []task
+	inflight  map[uint64]task
+	nextID    uint64
+	processed map[string]int    // 1 = HEAD, 2 = GET
+	canonical map[string]string // key => link, if they differ
+	refs      map[string][]string
+	originals map[string][]string // link => original hrefs
+	results   []Result
+}
+
+// Return a new in-memory store
+func newMemoryStore(stateDir string) *memoryStore {
+	return &memoryStore{
+		stateDir:  stateDir,
+		inflight:  make(map[uint64]task),
+		processed: make(map[string]int),
+		canonical: make(map[string]string),
+		refs:      make(map[string][]string),
+		originals: make(map[string][]string),
+	}
+}
+
+func (s *memoryStore) push(tasks []task) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pending = append(s.pending, tasks...)
+
+	return nil
+}
+
+func (s *memoryStore) nextWave(admit func(t *task, seen seenLinks) bool) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.pending) == 0 {
+		return false, nil
+	}
+
+	sortTasks(s.pending)
+
+	depth := s.pending[0].depth
+	n := 0
+	for n < len(s.pending) && s.pending[n].depth == depth {
+		t := s.pending[n]
+		if admit(&t, memorySeen{s}) {
+			s.nextID++
+			t.id = s.nextID
+			s.queue = append(s.queue, t)
+		}
+		n++
+	}
+
+	s.pending = append([]task{}, s.pending[n:]...)
+
+	return true, nil
+}
+
+func (s *memoryStore) claim(n int) ([]task, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if n > len(s.queue) {
+		n = len(s.queue)
+	}
+
+	tasks := append([]task{}, s.queue[:n]...)
+	s.queue = append([]task{}, s.queue[n:]...)
+
+	for _, t := range tasks {
+		s.inflight[t.id] = t
+	}
+
+	return tasks, nil
+}
+
+func (s *memoryStore) finish(t task) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.inflight, t.id)
+
+	return nil
+}
+
+func (s *memoryStore) addResult(r Result) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.results = append(s.results, r)
+
+	return nil
+}
+
+func (s *memoryStore) eachResult(fn func(r Result) error) error {
+	s.mutex.Lock()
+	sortResults(s.results)
+	results := s.results
+	s.mutex.Unlock()
+
+	for _, r := range results {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) referrers() (map[string][]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.refs, nil
+}
+
+func (s *memoryStore) hrefs() (map[string][]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.originals, nil
+}
+
+func (s *memoryStore) linkReferrers(link string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if list, ok := s.refs[link]; ok {
+		return sortedCopy(list), nil
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) linkHrefs(link string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if list, ok := s.originals[link]; ok {
+		return sortedCopy(list), nil
+	}
+	return nil, nil
+}
+
+// Return a sorted copy of a list
+func sortedCopy(list []string) []string {
+	c := append([]string{}, list...)
+	sort.Strings(c)
+	return c
+}
+
+func (s *memoryStore) close() error {
+	return nil
+}
+
+// Seen links of the in-memory store, the store is locked while admitting
+type memorySeen struct {
+	s *memoryStore
+}
+
+func (m memorySeen) weight(key string) (string, int, bool) {
+	w, ok := m.s.processed[key]
+	if link, found := m.s.canonical[key]; found {
+		return link, w, ok
+	}
+	return key, w, ok
+}
+
+func (m memorySeen) setWeight(key, link string, weight int) {
+	m.s.processed[key] = weight
+	if link != key {
+		m.s.canonical[key] = link
+	}
+}
+
+func (m memorySeen) addReferrer(link, referer string) {
+	refs, ok := m.s.refs[link]
+	if !ok {
+		refs = []string{}
+	}
+	if referer != "" && !slices.Contains(refs, referer) {
+		refs = append(refs, referer)
+	}
+	m.s.refs[link] = refs
+}
+
+func (m memorySeen) addHref(link, href string) {
+	if !slices.Contains(m.s.originals[link], href) {
+		m.s.originals[link] = append(m.s.originals[link], href)
+	}
+}
@@ -0,0 +1,542 @@
+package validator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// database file of the disk store
+const storeFile = "crawl.db"
+
+// number of pending tasks admitted per transaction
+const boltWaveBatch = 1000
+
+// maximum length of the strings in keys, bbolt keys being limited to 32KB
+const boltKeyBytes = 1024
+
+// Buckets of the disk store. The strings in keys are bounded, see boundedKey.
+var (
+	bucketPending   = []byte("pending")   // wave order key => task
+	bucketQueue     = []byte("queue")     // id => task
+	bucketInflight  = []byte("inflight")  // id => task
+	bucketProcessed = []byte("processed") // key => action weight & link, if it differs
+	bucketReferrers = []byte("referrers") // link \0 referer => link \0 referer
+	bucketHrefs     = []byte("hrefs")     // link \0 href => link \0 href
+	bucketResults   = []byte("results")   // url \0 type \0 id => result
+	bucketMeta      = []byte("meta")      // "checkpoint" => checkpoint metadata
+
+	boltBuckets = [][]byte{bucketPending, bucketQueue, bucketInflight, bucketProcessed, bucketReferrers, bucketHrefs, bucketResults, bucketMeta}
+)
+
+// Disk store, an embedded bbolt database. Only the tasks being admitted or
+// claimed are held in memory.
+type boltStore struct {
+	db      *bolt.DB
+	tempDir string // removed when closed, if set
+}
+
+// Open the disk store in dir, or a temporary directory if empty. An existing
+// store is only kept when resuming.
+func newBoltStore(dir string, resume bool) (*boltStore, error) {
+	s := &boltStore{}
+
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "web-validator-")
+		if err != nil {
+			return nil, err
+		}
+		dir = tmp
+		s.tempDir = tmp
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	file := filepath.Join(dir, storeFile)
+
+	if !resume {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(file, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	// the store is synced when a checkpoint is written
+	db.NoSync = true
+	s.db = db
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range boltBuckets {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = s.close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Return an 8 byte big-endian key
+func uint64Key(n uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, n)
+	return k
+}
+
+// Return a key of bounded length sorting like k: k itself if short enough,
+// else its first boltKeyBytes followed by its hash. Long keys sharing the
+// first bytes are sorted by hash.
+func boundedKey(k []byte) []byte {
+	if len(k) <= boltKeyBytes {
+		return k
+	}
+
+	sum := sha256.Sum256(k)
+	return append(k[:boltKeyBytes:boltKeyBytes], sum[:]...)
+}
+
+// Return the pending key of a task, sorting in wave order (see sortTasks)
+func pendingKey(t task) []byte {
+	k := []byte(t.link)
+	k = append(k, 0, byte(255-actionWeight(t.action)))
+	k = append(k, t.referer...)
+	k = append(append(k, 0), t.href...)
+	return append(uint64Key(uint64(t.depth)), boundedKey(k)...)
+}
+
+// Return the key of a result, sorting by URL & type
+func resultPrefix(link, resultType string) []byte {
+	k := append([]byte(link), 0)
+	k = append(k, resultType...)
+	return boundedKey(append(k, 0))
+}
+
+// Return the key & value of a link \0 value bucket. The value holds both
+// strings as the key may be bounded.
+func linkKey(link, v string) ([]byte, []byte) {
+	data := append(append([]byte(link), 0), v...)
+	return boundedKey(append([]byte{}, data...)), data
+}
+
+// Encode a task
+func encodeTask(t task) ([]byte, error) {
+	return json.Marshal(newCheckpointTask(t))
+}
+
+// Decode a task
+func decodeTask(data []byte) (task, error) {
+	ct := checkpointTask{}
+	err := json.Unmarshal(data, &ct)
+	return ct.task(), err
+}
+
+func (s *boltStore) push(tasks []task) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketPending)
+		for _, t := range tasks {
+			v, err := encodeTask(t)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(pendingKey(t), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) nextWave(admit func(t *task, seen seenLinks) bool) (bool, error) {
+	var depth []byte
+
+	for {
+		more := false
+
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			pending := tx.Bucket(bucketPending)
+			queue := tx.Bucket(bucketQueue)
+			seen := &boltSeen{tx: tx}
+
+			c := pending.Cursor()
+			k, v := c.First()
+			if k == nil {
+				return nil
+			}
+			if depth == nil {
+				depth = append([]byte{}, k[:8]...)
+			}
+
+			keys := [][]byte{}
+			for ; k != nil && bytes.Equal(k[:8], depth) && len(keys) < boltWaveBatch; k, v = c.Next() {
+				keys = append(keys, append([]byte{}, k...))
+
+				t, err := decodeTask(v)
+				if err != nil {
+					return err
+				}
+
+				if !admit(&t, seen) {
+					continue
+				}
+
+				id, err := queue.NextSequence()
+				if err != nil {
+					return err
+				}
+				t.id = id
+
+				data, err := encodeTask(t)
+				if err != nil {
+					return err
+				}
+				if err := queue.Put(uint64Key(id), data); err != nil {
+					return err
+				}
+			}
+
+			more = k != nil && bytes.Equal(k[:8], depth)
+
+			if seen.err != nil {
+				return seen.err
+			}
+
+			for _, k := range keys {
+				if err := pending.Delete(k); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil || !more {
+			return depth != nil, err
+		}
+	}
+}
+
+func (s *boltStore) claim(n int) ([]task, error) {
+	tasks := []task{}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		queue := tx.Bucket(bucketQueue)
+		inflight := tx.Bucket(bucketInflight)
+
+		keys := [][]byte{}
+		c := queue.Cursor()
+		for k, v := c.First(); k != nil && len(keys) < n; k, v = c.Next() {
+			t, err := decodeTask(v)
+			if err != nil {
+				return err
+			}
+			t.id = binary.BigEndian.Uint64(k)
+			tasks = append(tasks, t)
+			keys = append(keys, append([]byte{}, k...))
+
+			if err := inflight.Put(k, v); err != nil {
+				return err
+			}
+		}
+
+		for _, k := range keys {
+			if err := queue.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return tasks, err
+}
+
+func (s *boltStore) finish(t task) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketInflight).Delete(uint64Key(t.id))
+	})
+}
+
+func (s *boltStore) addResult(r Result) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketResults)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(append(resultPrefix(r.URL, r.Type), uint64Key(id)...), data)
+	})
+}
+
+func (s *boltStore) eachResult(fn func(r Result) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		// the results of long URLs sharing the bounded part of their keys are
+		// sorted by hash, so they are sorted again
+		var group []Result
+		var groupKey []byte
+
+		flush := func() error {
+			sortResults(group)
+			for _, r := range group {
+				if err := fn(r); err != nil {
+					return err
+				}
+			}
+			group, groupKey = nil, nil
+			return nil
+		}
+
+		err := tx.Bucket(bucketResults).ForEach(func(k, v []byte) error {
+			r := Result{}
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+
+			if len(k) > boltKeyBytes+8 {
+				if groupKey != nil && !bytes.Equal(k[:boltKeyBytes], groupKey) {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+				groupKey = append([]byte{}, k[:boltKeyBytes]...)
+				group = append(group, r)
+				return nil
+			}
+
+			if err := flush(); err != nil {
+				return err
+			}
+			return fn(r)
+		})
+		if err != nil {
+			return err
+		}
+
+		return flush()
+	})
+}
+
+func (s *boltStore) referrers() (map[string][]string, error) {
+	return s.linkLists(bucketReferrers)
+}
+
+func (s *boltStore) hrefs() (map[string][]string, error) {
+	return s.linkLists(bucketHrefs)
+}
+
+// Return the lists of a link \0 value bucket, links with an empty value
+// have an empty list
+func (s *boltStore) linkLists(bucket []byte) (map[string][]string, error) {
+	lists := make(map[string][]string)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(_, data []byte) error {
+			i := bytes.IndexByte(data, 0)
+			link, v := string(data[:i]), string(data[i+1:])
+			if _, ok := lists[link]; !ok {
+				lists[link] = []string{}
+			}
+			if v != "" {
+				lists[link] = append(lists[link], v)
+			}
+			return nil
+		})
+	})
+
+	for _, l := range lists {
+		sort.Strings(l)
+	}
+
+	return lists, err
+}
+
+func (s *boltStore) linkReferrers(link string) ([]string, error) {
+	return s.linkList(bucketReferrers, link)
+}
+
+func (s *boltStore) linkHrefs(link string) ([]string, error) {
+	return s.linkList(bucketHrefs, link)
+}
+
+// Return the sorted list of a link in a link \0 value bucket, or nil if the
+// link has no keys
+func (s *boltStore) linkList(bucket []byte, link string) ([]string, error) {
+	var list []string
+	prefix := append([]byte(link), 0)
+
+	// keys of long links only share the bounded part of the link
+	seek := prefix
+	if len(seek) > boltKeyBytes {
+		seek = seek[:boltKeyBytes]
+	}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		for k, data := c.Seek(seek); k != nil && bytes.HasPrefix(k, seek); k, data = c.Next() {
+			if !bytes.HasPrefix(data, prefix) {
+				continue
+			}
+			if list == nil {
+				list = []string{}
+			}
+			if v := string(data[len(prefix):]); v != "" {
+				list = append(list, v)
+			}
+		}
+		return nil
+	})
+
+	sort.Strings(list)
+
+	return list, err
+}
+
+func (s *boltStore) checkpoint(meta checkpointMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMeta).Put([]byte("checkpoint"), data)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.db.Sync()
+}
+
+func (s *boltStore) restore() (checkpointMeta, bool, error) {
+	meta := checkpointMeta{}
+	found := false
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketMeta).Get([]byte("checkpoint"))
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return err
+		}
+		found = true
+
+		// queue the in-flight tasks again, unless they completed before the
+		// checkpoint was written
+		inflight := tx.Bucket(bucketInflight)
+		queue := tx.Bucket(bucketQueue)
+		results := tx.Bucket(bucketResults).Cursor()
+
+		keys := [][]byte{}
+		err := inflight.ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte{}, k...))
+
+			t, err := decodeTask(v)
+			if err != nil {
+				return err
+			}
+
+			prefix := resultPrefix(t.link, t.resultType())
+			if rk, _ := results.Seek(prefix); rk != nil && bytes.HasPrefix(rk, prefix) {
+				return nil
+			}
+
+			return queue.Put(k, v)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if err := inflight.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return meta, found, err
+}
+
+func (s *boltStore) close() error {
+	err := s.db.Close()
+
+	if s.tempDir != "" {
+		if rerr := os.RemoveAll(s.tempDir); err == nil {
+			err = rerr
+		}
+	}
+
+	return err
+}
+
+// Seen links of the disk store, within the transaction admitting a wave
+type boltSeen struct {
+	tx  *bolt.Tx
+	err error // first write error
+}
+
+func (b *boltSeen) weight(key string) (string, int, bool) {
+	v := b.tx.Bucket(bucketProcessed).Get(boundedKey([]byte(key)))
+	if len(v) == 0 {
+		return key, 0, false
+	}
+	if len(v) > 1 {
+		return string(v[1:]), int(v[0]), true
+	}
+	return key, int(v[0]), true
+}
+
+func (b *boltSeen) setWeight(key, link string, weight int) {
+	v := []byte{byte(weight)}
+	if link != key {
+		v = append(v, link...)
+	}
+	b.put(bucketProcessed, boundedKey([]byte(key)), v)
+}
+
+func (b *boltSeen) addReferrer(link, referer string) {
+	// the link without a referer, so links without referrers are listed too
+	b.putLink(bucketReferrers, link, "")
+	if referer != "" {
+		b.putLink(bucketReferrers, link, referer)
+	}
+}
+
+func (b *boltSeen) addHref(link, href string) {
+	b.putLink(bucketHrefs, link, href)
+}
+
+// Put a value of a link \0 value bucket, keeping the first error
+func (b *boltSeen) putLink(bucket []byte, link, v string) {
+	k, data := linkKey(link, v)
+	b.put(bucket, k, data)
+}
+
+// Put a value, keeping the first error
+func (b *boltSeen) put(bucket, k, v []byte) {
+	if b.err == nil {
+		b.err = b.tx.Bucket(bucket).Put(k, v)
+	}
+}
@@ -0,0 +1,88 @@
+package validator
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats of the connections used by the crawl
+type ConnStats struct {
+	New    int64 `json:"new"`
+	Reused int64 `json:"reused"`
+}
+
+// Return the transport shared by all requests of the crawl
+func newTransport(opts Options) http.RoundTripper {
+	if opts.Transport != nil {
+		return opts.Transport
+	}
+
+	maxIdle := opts.MaxIdleConnsPerHost
+	if maxIdle < 1 {
+		// enough for every worker to keep a connection to the site
+		maxIdle = opts.Threads
+	}
+
+	dialTimeout := opts.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = 30 * time.Second
+	}
+
+	tlsTimeout := opts.TLSHandshakeTimeout
+	if tlsTimeout <= 0 {
+		tlsTimeout = 10 * time.Second
+	}
+
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		// HTTP/2 is not attempted with a custom dialer unless forced
+		ForceAttemptHTTP2:     !opts.DisableHTTP2,
+		DisableCompression:    opts.DisableCompression,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   maxIdle,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   tlsTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return t
+}
+
+// Return a new request which counts whether its connection was reused
+func (c *Crawler) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&c.connStats.Reused, 1)
+			} else {
+				atomic.AddInt64(&c.connStats.New, 1)
+			}
+		},
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+
+	return req, nil
+}
+
+// Close a response body, reading what is left (up to a limit) so the
+// connection can be reused
+func closeBody(res *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 256<<10))
+	_ = res.Body.Close()
+}
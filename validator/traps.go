@@ -0,0 +1,160 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Crawler traps found, kept with the checkpoint
+type trapState struct {
+	Variants map[string]int   `json:"variants,omitempty"` // pages with a query crawled per path
+	Capped   map[string]int   `json:"capped,omitempty"`   // pages crawled per page cap pattern
+	Found    map[string]*trap `json:"found,omitempty"`
+}
+
+// Crawler trap, reported once with the number of distinct links skipped
+type trap struct {
+	URL     string `json:"url"` // the first link skipped
+	Referer string `json:"referer,omitempty"`
+	Depth   int    `json:"depth"`
+	Reason  string `json:"reason"`
+	Skipped int    `json:"skipped"`
+}
+
+// Page cap pattern
+type pageCap struct {
+	pattern string
+	re      *regexp.Regexp
+	max     int
+}
+
+// Return a new trap state
+func newTrapState() *trapState {
+	return &trapState{
+		Variants: make(map[string]int),
+		Capped:   make(map[string]int),
+		Found:    make(map[string]*trap),
+	}
+}
+
+// Compile the page cap patterns, sorted so the first matching pattern is
+// always the same
+func newPageCaps(caps map[string]int) ([]pageCap, error) {
+	patterns := []string{}
+	for p := range caps {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+
+	pageCaps := []pageCap{}
+	for _, p := range patterns {
+		re, err := wildcardPatterns([]string{p})
+		if err != nil {
+			return nil, err
+		}
+		if len(re) == 0 || caps[p] <= 0 {
+			continue
+		}
+		pageCaps = append(pageCaps, pageCap{pattern: p, re: re[0], max: caps[p]})
+	}
+
+	return pageCaps, nil
+}
+
+// Whether a page to be admitted is a likely crawler trap, in which case it is
+// skipped & counted: URLs which are too long, repeat a path segment, have too
+// many query variants of the same path, or exceed a page cap. Called while
+// admitting, so the same pages are skipped every run.
+func (c *Crawler) trapped(t *task) bool {
+	u, err := url.Parse(t.link)
+	if err != nil {
+		return false
+	}
+
+	page := u.Scheme + "://" + u.Host + u.EscapedPath()
+
+	if c.opts.MaxURLLength > 0 && len(t.link) > c.opts.MaxURLLength {
+		c.addTrap("length "+page, t, fmt.Sprintf("links longer than %d characters", c.opts.MaxURLLength))
+		return true
+	}
+
+	if c.opts.MaxRepeats > 0 {
+		counts := make(map[string]int)
+		for _, s := range strings.Split(u.Path, "/") {
+			if s == "" {
+				continue
+			}
+			counts[s]++
+			if counts[s] > c.opts.MaxRepeats {
+				c.addTrap("repeats "+u.Host+" "+s, t, fmt.Sprintf("path segment %q repeating more than %d times", s, c.opts.MaxRepeats))
+				return true
+			}
+		}
+	}
+
+	if c.opts.MaxVariants > 0 && u.RawQuery != "" && c.traps.Variants[page] >= c.opts.MaxVariants {
+		c.addTrap("variants "+page, t, fmt.Sprintf("more than %d query variants of %s", c.opts.MaxVariants, page))
+		return true
+	}
+
+	for _, p := range c.pageCaps {
+		if p.re.MatchString(t.link) && c.traps.Capped[p.pattern] >= p.max {
+			c.addTrap("cap "+p.pattern, t, fmt.Sprintf("more than %d pages matching %s", p.max, p.pattern))
+			return true
+		}
+	}
+
+	// the page is admitted
+	if c.opts.MaxVariants > 0 && u.RawQuery != "" {
+		c.traps.Variants[page]++
+	}
+
+	for _, p := range c.pageCaps {
+		if p.re.MatchString(t.link) {
+			c.traps.Capped[p.pattern]++
+		}
+	}
+
+	return false
+}
+
+// Count a link skipped by a trap, keeping the first link. Trapped links are
+// seen, so each link is only counted once.
+func (c *Crawler) addTrap(key string, t *task, reason string) {
+	if tr, ok := c.traps.Found[key]; ok {
+		tr.Skipped++
+		return
+	}
+
+	c.traps.Found[key] = &trap{URL: t.link, Referer: t.referer, Depth: t.depth, Reason: reason, Skipped: 1}
+}
+
+// Add a crawler-trap result for each trap found, once the crawl is finished.
+// Nothing is requested, so all are added even if the crawl is cancelled meanwhile.
+func (c *Crawler) addTrapResults(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+
+	keys := []string{}
+	for k := range c.traps.Found {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		tr := c.traps.Found[k]
+		output := Result{URL: tr.URL, Type: "trap", Depth: tr.Depth}
+		// the count is not part of the message, which is matched by baselines
+		i := newIssue("crawler-trap", tr.Referer, tr.URL, "links skipped, "+tr.Reason)
+		i.Skipped = tr.Skipped
+		output.addIssue(i)
+		c.addResult(ctx, output, time.Now())
+	}
+
+	// the results are stored, a resumed crawl only reports new traps
+	c.traps.Found = make(map[string]*trap)
+}
@@ -1,17 +1,18 @@
-package main
+package validator
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
-	"sync"
 	"time"
 )
 
 var (
-	ignoreMatches = []*regexp.Regexp{
+	// URLs which are always ignored
+	defaultIgnoreMatches = []*regexp.Regexp{
 		regexp.MustCompile(`^https?://(www\.)?linkedin\.com`),
 		regexp.MustCompile(`^https://(.*)\.google\.com`),
 		regexp.MustCompile(`^https://(.*)\.cloudflare\.com`),
@@ -23,57 +24,44 @@ var (
 // HEAD a link to get the status of the URL
 // Note: some sites block HEAD, so if a HEAD fails with a 404 or 405 error
 // then a getResponse() is performed is done (outbound links only)
-func head(httpLink string, wg *sync.WaitGroup) {
-	wg.Add(1)
-	defer wg.Done()
-	output := result{}
+func (c *Crawler) head(ctx context.Context, httpLink string, depth int) {
+	start := time.Now()
+	output := Result{}
 	output.URL = httpLink
-	timeout := time.Duration(time.Duration(timeoutSeconds) * time.Second)
-
-	client := http.Client{
-		Timeout:       timeout,
-		CheckRedirect: redirectMiddleware,
-	}
-
-	req, err := http.NewRequest("HEAD", httpLink, nil)
+	output.Depth = depth
+	req, err := c.newRequest(ctx, "HEAD", httpLink, nil)
 	if err != nil {
-		errorsProcessed++
-		output.Errors = append(output.Errors, fmt.Sprintf("%s", err))
-		results = append(results, output)
+		output.addRequestError(err)
+		c.addResult(ctx, output, start)
 		return
 	}
 
-	req.Header.Set("User-Agent", userAgent)
-
-	res, err := client.Do(req)
+	res, err := c.client.Do(req)
 	if err != nil {
-		errorsProcessed++
 		if res != nil {
 			loc := res.Header.Get("Location")
 			output.StatusCode = res.StatusCode
 			if loc != "" {
 				full, err := absoluteURL(loc, httpLink)
 				if err == nil {
-					output.Redirect = full
-					results = append(results, output)
-					addQueueLink(full, "head", httpLink, 0, wg)
+					output.addRedirect(full)
+					c.addResult(ctx, output, start)
+					c.queueRedirect(ctx, full, "head", httpLink, depth, false)
 					return
 				}
 			}
 		}
-		output.Errors = append(output.Errors, fmt.Sprintf("%s", err))
-		results = append(results, output)
+		output.addRequestError(err)
+		c.addResult(ctx, output, start)
 		return
 	}
 
-	defer func() { _ = res.Body.Close() }()
+	defer closeBody(res)
 
 	// some hosts block HEAD requests, so we do a standard GET instead
 	if res.StatusCode == 404 || res.StatusCode == 405 {
-		isOutbound := baseDomain != "" && getHost(httpLink) != baseDomain
-
-		if isOutbound {
-			getResponse(httpLink, wg)
+		if c.isOutbound(httpLink) {
+			c.getResponse(ctx, httpLink, depth)
 			return
 		}
 	}
@@ -81,65 +69,110 @@ func head(httpLink string, wg *sync.WaitGroup) {
 	output.StatusCode = res.StatusCode
 
 	if output.StatusCode != 200 {
-		errorsProcessed++
-		output.Errors = append(output.Errors, fmt.Sprintf("returned status %d", output.StatusCode))
+		output.addStatusError()
 	}
 
-	results = append(results, output)
+	c.addResult(ctx, output, start)
 }
 
 // Fallback for failed HEAD requests
-func getResponse(httpLink string, wg *sync.WaitGroup) {
-	output := result{}
+func (c *Crawler) getResponse(ctx context.Context, httpLink string, depth int) {
+	start := time.Now()
+	output := Result{}
 	output.URL = httpLink
-	timeout := time.Duration(time.Duration(timeoutSeconds) * time.Second)
-
-	client := http.Client{
-		Timeout:       timeout,
-		CheckRedirect: redirectMiddleware,
-	}
-
-	req, err := http.NewRequest("GET", httpLink, nil)
+	output.Depth = depth
+	req, err := c.newRequest(ctx, "GET", httpLink, nil)
 	if err != nil {
-		errorsProcessed++
-		output.Errors = append(output.Errors, fmt.Sprintf("%s", err))
-		results = append(results, output)
+		output.addRequestError(err)
+		c.addResult(ctx, output, start)
 		return
 	}
 
-	req.Header.Set("User-Agent", userAgent)
-
-	res, err := client.Do(req)
+	res, err := c.client.Do(req)
 	if err != nil {
-		errorsProcessed++
 		if res != nil {
 			loc := res.Header.Get("Location")
 			output.StatusCode = res.StatusCode
 			if loc != "" {
 				full, err := absoluteURL(loc, httpLink)
 				if err == nil {
-					output.Redirect = full
-					results = append(results, output)
-					addQueueLink(full, "head", httpLink, 0, wg)
+					output.addRedirect(full)
+					c.addResult(ctx, output, start)
+					c.queueRedirect(ctx, full, "head", httpLink, depth, false)
 					return
 				}
 			}
 		}
-		output.Errors = append(output.Errors, fmt.Sprintf("%s", err))
-		results = append(results, output)
+		output.addRequestError(err)
+		c.addResult(ctx, output, start)
 		return
 	}
 
-	defer func() { _ = res.Body.Close() }()
+	defer closeBody(res)
 
 	output.StatusCode = res.StatusCode
 
 	if output.StatusCode != 200 {
-		errorsProcessed++
-		output.Errors = append(output.Errors, fmt.Sprintf("returned status %d", output.StatusCode))
+		output.addStatusError()
 	}
 
-	results = append(results, output)
+	c.addResult(ctx, output, start)
+}
+
+// Whether a link is to another host than the internal hosts (those of the
+// start URLs & Options.Hosts, and their subdomains if Options.Subdomains)
+func (c *Crawler) isOutbound(httpLink string) bool {
+	host := getHost(httpLink)
+	if c.internalHosts[host] {
+		return false
+	}
+
+	if c.opts.Subdomains {
+		for h := range c.internalHosts {
+			if strings.HasSuffix(host, "."+h) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Return the action of a linked page: parse if in scope to be followed
+// (Options.Include, NoFollow & PathPrefix), else head to only check it.
+// The start URLs & assets are not scoped.
+func (c *Crawler) pageAction(httpLink string) string {
+	if c.inScope(httpLink) {
+		return "parse"
+	}
+	return "head"
+}
+
+// Whether a page is in scope to be followed
+func (c *Crawler) inScope(httpLink string) bool {
+	if c.opts.PathPrefix != "" {
+		u, err := url.Parse(httpLink)
+		if err != nil || !strings.HasPrefix(u.Path, c.opts.PathPrefix) {
+			return false
+		}
+	}
+
+	if len(c.includes) > 0 && !matchesAny(c.includes, httpLink) {
+		return false
+	}
+
+	return !matchesAny(c.noFollows, httpLink)
+}
+
+// Whether a link matches any of the patterns
+func matchesAny(patterns []*regexp.Regexp, httpLink string) bool {
+	for _, r := range patterns {
+		if r.MatchString(httpLink) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // Return the domain name (host) from a URL
@@ -175,11 +208,6 @@ func absoluteURL(link, baseLink string) (string, error) {
 		return link, err
 	}
 
-	// set global variable
-	if baseDomain == "" {
-		baseDomain = base.Host
-	}
-
 	result := base.ResolveReference(u)
 
 	// ensure link is HTTP(S)
@@ -205,18 +233,6 @@ func isMixedContent(src, ref string) bool {
 	return false
 }
 
-// Truncate a string
-func truncateString(str string, num int) string {
-	ts := str
-	if len(str) > num {
-		if num > 3 {
-			num -= 3
-		}
-		ts = str[0:num] + "..."
-	}
-	return ts
-}
-
 // Single function to return a "weight" (int) based on the action to
 // allow parsing of links that have already had a HEAD request (depth)
 func actionWeight(f string) int {
@@ -227,9 +243,9 @@ func actionWeight(f string) int {
 	return 1
 }
 
-// RedirectMiddleware will return an error on redirect if redirectWarnings == true
-func redirectMiddleware(req *http.Request, _ []*http.Request) error {
-	if redirectWarnings {
+// RedirectMiddleware will return an error on redirect if RedirectWarnings == true
+func (c *Crawler) redirectMiddleware(req *http.Request, _ []*http.Request) error {
+	if c.opts.RedirectWarnings {
 		return fmt.Errorf("%d redirect", req.Response.StatusCode)
 	}
 	return nil
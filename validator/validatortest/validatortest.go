@@ -0,0 +1,111 @@
+// Package validatortest crawls an http.Handler in-process, for checking a web
+// application for broken links & invalid HTML in `go test` without starting
+// a server.
+package validatortest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/axllent/web-validator/validator"
+)
+
+// DefaultURL is the start URL when Options.URL is not set
+const DefaultURL = "http://web-validator.test/"
+
+// Transport returns a RoundTripper which serves requests to host with the
+// handler, in memory. Requests to other hosts (outbound links, the Nu
+// validator) use http.DefaultTransport.
+func Transport(host string, h http.Handler) http.RoundTripper {
+	return &handlerTransport{host: host, handler: h, fallback: http.DefaultTransport}
+}
+
+// Handler transport
+type handlerTransport struct {
+	host     string
+	handler  http.Handler
+	fallback http.RoundTripper
+}
+
+// RoundTrip serves the request with the handler
+func (t *handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.fallback.RoundTrip(req)
+	}
+
+	// turn the client request into a server request
+	r := req.Clone(req.Context())
+	r.RequestURI = req.URL.RequestURI()
+	r.RemoteAddr = "192.0.2.1:1234"
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, r)
+
+	res := rec.Result()
+	res.Request = req
+	if req.Method == http.MethodHead {
+		res.Body = http.NoBody
+	}
+
+	return res, nil
+}
+
+// Check crawls the handler with the options, reporting every error as a test
+// error, and warnings & notices in the test log. The transport of the options
+// is replaced with the handler, and the URL defaults to DefaultURL. The report
+// is closed when the test finishes.
+func Check(tb testing.TB, h http.Handler, opts validator.Options) *validator.Report {
+	tb.Helper()
+
+	if opts.URL == "" {
+		opts.URL = DefaultURL
+	}
+
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		tb.Fatalf("web-validator: %s", err)
+	}
+
+	opts.Transport = Transport(u.Host, h)
+
+	c, err := validator.New(opts)
+	if err != nil {
+		tb.Fatalf("web-validator: %s", err)
+	}
+
+	rpt, err := c.Run(context.Background())
+	if rpt != nil {
+		tb.Cleanup(func() { _ = rpt.Close() })
+	}
+	if err != nil {
+		tb.Fatalf("web-validator: %s", err)
+	}
+
+	err = rpt.EachResult(func(r validator.Result) error {
+		for _, i := range r.Issues {
+			msg := i.Message
+			if i.Validation != nil {
+				msg = fmt.Sprintf("line %d: %s", i.Validation.LastLine, msg)
+			}
+
+			if i.Severity == validator.SeverityError {
+				tb.Errorf("%s: [%s] %s", r.URL, i.Code, msg)
+			} else {
+				tb.Logf("%s: [%s] %s (%s)", r.URL, i.Code, msg, i.Severity)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		tb.Fatalf("web-validator: %s", err)
+	}
+
+	return rpt
+}